@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// BasicAuth returns middleware for Handler.SetAuth that rejects requests not
+// carrying the given HTTP basic authentication credentials.
+func BasicAuth(username, password string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, p, ok := r.BasicAuth()
+			if !ok || !equal(u, username) || !equal(p, password) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="cache admin"`)
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BearerToken returns middleware for Handler.SetAuth that rejects requests not
+// carrying an "Authorization: Bearer <token>" header with the given token.
+func BearerToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			const prefix = "Bearer "
+			if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) || !equal(auth[len(prefix):], token) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// equal compares secrets in constant time.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
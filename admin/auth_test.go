@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+func TestBasicAuth(t *testing.T) {
+	h := New(cache.New(cache.DefaultExpiration, 0))
+	h.SetAuth(BasicAuth("admin", "secret"))
+
+	for _, c := range []struct {
+		user, password string
+		want           int
+	}{
+		{"admin", "secret", http.StatusOK},
+		{"admin", "wrong", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/stats", nil)
+		if c.user != "" {
+			r.SetBasicAuth(c.user, c.password)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.want {
+			t.Errorf("%s:%s got %d, expected %d", c.user, c.password, w.Code, c.want)
+		}
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	h := New(cache.New(cache.DefaultExpiration, 0))
+	h.SetAuth(BearerToken("t0ken"))
+
+	for _, c := range []struct {
+		header string
+		want   int
+	}{
+		{"Bearer t0ken", http.StatusOK},
+		{"bearer t0ken", http.StatusOK},
+		{"Bearer t0ke", http.StatusUnauthorized},
+		{"t0ken", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/stats", nil)
+		r.Header.Set("Authorization", c.header)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.want {
+			t.Errorf("%q got %d, expected %d", c.header, w.Code, c.want)
+		}
+	}
+}
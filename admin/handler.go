@@ -0,0 +1,262 @@
+// Package admin provides an HTTP handler exposing a JSON API for inspecting
+// and purging the items of a cache.Cache.
+//
+// The handler serves the following routes, relative to where it is mounted
+// (use http.StripPrefix to mount it under a prefix):
+//
+//	GET    /keys?prefix=p   list the unexpired keys starting with p
+//	GET    /keys/{key}      get an item
+//	PUT    /keys/{key}      set an item from the request body; the optional
+//	                        ttl query parameter is a duration such as 90s,
+//	                        or "never"
+//	DELETE /keys/{key}      delete an item
+//	POST   /flush           delete all items
+//	POST   /delete-expired  delete all expired items
+//	GET    /stats           get item counts
+//
+// Keys containing a slash must have it escaped as %2F.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+// maxBodySize is the largest request body accepted by PUT.
+const maxBodySize = 10 << 20
+
+// An Encoder converts an item's value into one that encoding/json can
+// marshal.
+type Encoder func(x interface{}) (interface{}, error)
+
+// A Decoder converts the body of a PUT request into the value to store.
+type Decoder func(r *http.Request, body []byte) (interface{}, error)
+
+// A Handler serves the admin API for a cache. Its Set methods must be called
+// before it starts serving requests.
+type Handler struct {
+	c       *cache.Cache
+	encode  Encoder
+	decode  Decoder
+	handler http.Handler
+}
+
+// Returns a handler for c that encodes values with DefaultEncoder, decodes
+// them with DefaultDecoder, and doesn't authenticate requests.
+func New(c *cache.Cache) *Handler {
+	h := &Handler{
+		c:      c,
+		encode: DefaultEncoder,
+		decode: DefaultDecoder,
+	}
+	h.handler = http.HandlerFunc(h.route)
+	return h
+}
+
+// DefaultEncoder returns []byte values as strings if they are valid UTF-8, so
+// that they aren't base64-encoded, and returns other values unchanged.
+func DefaultEncoder(x interface{}) (interface{}, error) {
+	if b, ok := x.([]byte); ok && utf8.Valid(b) {
+		return string(b), nil
+	}
+	return x, nil
+}
+
+// DefaultDecoder decodes the body as JSON, so JSON strings are stored as
+// strings, numbers as float64, objects as map[string]interface{} and so on.
+func DefaultDecoder(r *http.Request, body []byte) (interface{}, error) {
+	var x interface{}
+	if err := json.Unmarshal(body, &x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Sets the function used to convert item values into JSON-marshalable values.
+func (h *Handler) SetEncoder(f Encoder) {
+	h.encode = f
+}
+
+// Sets the function used to convert PUT request bodies into item values.
+func (h *Handler) SetDecoder(f Decoder) {
+	h.decode = f
+}
+
+// Sets the middleware every request goes through before reaching the API,
+// typically to authenticate it. See BasicAuth and BearerToken.
+func (h *Handler) SetAuth(middleware func(http.Handler) http.Handler) {
+	h.handler = middleware(http.HandlerFunc(h.route))
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *Handler) route(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	switch {
+	case path == "/keys":
+		if allow(w, r, http.MethodGet) {
+			h.listKeys(w, r)
+		}
+	case strings.HasPrefix(path, "/keys/"):
+		k, err := url.PathUnescape(strings.TrimPrefix(path, "/keys/"))
+		if err != nil || k == "" {
+			writeError(w, http.StatusBadRequest, "invalid key")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			h.getKey(w, k)
+		case http.MethodPut:
+			h.putKey(w, r, k)
+		case http.MethodDelete:
+			if _, found := h.c.GetAndDelete(k); !found {
+				writeError(w, http.StatusNotFound, "key not found")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case path == "/flush":
+		if allow(w, r, http.MethodPost) {
+			h.c.Flush()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case path == "/delete-expired":
+		if allow(w, r, http.MethodPost) {
+			h.c.DeleteExpired()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case path == "/stats":
+		if allow(w, r, http.MethodGet) {
+			h.stats(w)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// allow reports whether r uses method, replying with an error if it doesn't.
+// GET routes also accept HEAD.
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || method == http.MethodGet && r.Method == http.MethodHead {
+		return true
+	}
+	if method == http.MethodGet {
+		w.Header().Set("Allow", "GET, HEAD")
+	} else {
+		w.Header().Set("Allow", method)
+	}
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	b, _ := json.Marshal(map[string]string{"error": msg})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
+
+func (h *Handler) listKeys(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	keys := []string{}
+	h.c.Range(func(k string, item cache.Item) bool {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	sort.Strings(keys)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// An item is the JSON representation of a cache item.
+type item struct {
+	Key        string      `json:"key"`
+	Value      interface{} `json:"value"`
+	Type       string      `json:"type"`
+	Expiration *time.Time  `json:"expiration"`
+}
+
+func (h *Handler) getKey(w http.ResponseWriter, k string) {
+	x, exp, found := h.c.GetWithExpiration(k)
+	if !found {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	v, err := h.encode(x)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "encoding value: "+err.Error())
+		return
+	}
+	it := item{Key: k, Value: v, Type: fmt.Sprintf("%T", x)}
+	if !exp.IsZero() {
+		it.Expiration = &exp
+	}
+	writeJSON(w, http.StatusOK, it)
+}
+
+func (h *Handler) putKey(w http.ResponseWriter, r *http.Request, k string) {
+	d := cache.DefaultExpiration
+	if ttl := r.URL.Query().Get("ttl"); ttl == "never" {
+		d = cache.NoExpiration
+	} else if ttl != "" {
+		var err error
+		d, err = time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid ttl")
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	x, err := h.decode(r, body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "decoding value: "+err.Error())
+		return
+	}
+	h.c.Set(k, x, d)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) stats(w http.ResponseWriter) {
+	live, expired := h.c.ItemCounts()
+	writeJSON(w, http.StatusOK, map[string]int{
+		"items":   live + expired,
+		"expired": expired,
+	})
+}
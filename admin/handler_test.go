@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+func do(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("Invalid JSON response %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestGetKey(t *testing.T) {
+	tc := cache.New(cache.DefaultExpiration, 0)
+	h := New(tc)
+	tc.Set("foo", []byte("bar"), time.Hour)
+	tc.Set("a/b", 42, cache.NoExpiration)
+
+	w := do(t, h, "GET", "/keys/foo", "")
+	if w.Code != http.StatusOK {
+		t.Fatal("GET /keys/foo returned", w.Code)
+	}
+	var it struct {
+		Key        string
+		Value      interface{}
+		Type       string
+		Expiration *time.Time
+	}
+	decodeBody(t, w, &it)
+	if it.Key != "foo" || it.Value != "bar" || it.Type != "[]uint8" || it.Expiration == nil {
+		t.Error("Unexpected item:", it)
+	}
+
+	w = do(t, h, "GET", "/keys/a%2Fb", "")
+	it.Expiration = nil
+	decodeBody(t, w, &it)
+	if it.Key != "a/b" || it.Value != float64(42) || it.Expiration != nil {
+		t.Error("Unexpected item:", it)
+	}
+
+	if w := do(t, h, "GET", "/keys/missing", ""); w.Code != http.StatusNotFound {
+		t.Error("GET of a missing key returned", w.Code)
+	}
+}
+
+func TestPutDeleteKey(t *testing.T) {
+	tc := cache.New(time.Minute, 0)
+	h := New(tc)
+
+	if w := do(t, h, "PUT", "/keys/foo", `{"a":[1,2]}`); w.Code != http.StatusNoContent {
+		t.Fatal("PUT returned", w.Code, w.Body.String())
+	}
+	x, found := tc.Get("foo")
+	if m, ok := x.(map[string]interface{}); !found || !ok || len(m["a"].([]interface{})) != 2 {
+		t.Error("foo is not the decoded JSON object:", x)
+	}
+	if ttl, _ := tc.TTL("foo"); ttl <= 59*time.Second || ttl > time.Minute {
+		t.Error("PUT without ttl didn't use the default expiration:", ttl)
+	}
+
+	do(t, h, "PUT", "/keys/foo?ttl=90s", `"bar"`)
+	if ttl, _ := tc.TTL("foo"); ttl <= 89*time.Second || ttl > 90*time.Second {
+		t.Error("Unexpected TTL:", ttl)
+	}
+	do(t, h, "PUT", "/keys/foo?ttl=never", `"bar"`)
+	if ttl, _ := tc.TTL("foo"); ttl != cache.NoExpiration {
+		t.Error("ttl=never didn't make the item persistent:", ttl)
+	}
+	if w := do(t, h, "PUT", "/keys/foo?ttl=-1s", `"bar"`); w.Code != http.StatusBadRequest {
+		t.Error("PUT with a negative ttl returned", w.Code)
+	}
+	if w := do(t, h, "PUT", "/keys/foo", `{`); w.Code != http.StatusBadRequest {
+		t.Error("PUT with invalid JSON returned", w.Code)
+	}
+
+	if w := do(t, h, "DELETE", "/keys/foo", ""); w.Code != http.StatusNoContent {
+		t.Error("DELETE returned", w.Code)
+	}
+	if w := do(t, h, "DELETE", "/keys/foo", ""); w.Code != http.StatusNotFound {
+		t.Error("Second DELETE returned", w.Code)
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	tc := cache.New(cache.DefaultExpiration, 0)
+	h := New(tc)
+	tc.Set("user:2", 1, cache.DefaultExpiration)
+	tc.Set("user:1", 1, cache.DefaultExpiration)
+	tc.Set("session:1", 1, cache.DefaultExpiration)
+
+	var resp struct{ Keys []string }
+	decodeBody(t, do(t, h, "GET", "/keys?prefix=user:", ""), &resp)
+	if len(resp.Keys) != 2 || resp.Keys[0] != "user:1" || resp.Keys[1] != "user:2" {
+		t.Error("Unexpected keys:", resp.Keys)
+	}
+	decodeBody(t, do(t, h, "GET", "/keys", ""), &resp)
+	if len(resp.Keys) != 3 {
+		t.Error("Unexpected keys:", resp.Keys)
+	}
+}
+
+func TestFlushDeleteExpiredStats(t *testing.T) {
+	tc := cache.New(cache.DefaultExpiration, 0)
+	h := New(tc)
+	tc.Set("a", 1, cache.DefaultExpiration)
+	tc.Set("b", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+
+	var stats map[string]int
+	decodeBody(t, do(t, h, "GET", "/stats", ""), &stats)
+	if stats["items"] != 2 || stats["expired"] != 1 {
+		t.Error("Unexpected stats:", stats)
+	}
+
+	if w := do(t, h, "GET", "/delete-expired", ""); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST" {
+		t.Error("GET /delete-expired returned", w.Code)
+	}
+	if w := do(t, h, "POST", "/delete-expired", ""); w.Code != http.StatusNoContent {
+		t.Error("POST /delete-expired returned", w.Code)
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Error("Item count after delete-expired is not 1:", n)
+	}
+	if w := do(t, h, "POST", "/flush", ""); w.Code != http.StatusNoContent {
+		t.Error("POST /flush returned", w.Code)
+	}
+	if n := tc.ItemCount(); n != 0 {
+		t.Error("Item count after flush is not 0:", n)
+	}
+	if w := do(t, h, "GET", "/bogus", ""); w.Code != http.StatusNotFound {
+		t.Error("GET /bogus returned", w.Code)
+	}
+}
+
+func TestStatsNamespace(t *testing.T) {
+	tc := cache.New(cache.DefaultExpiration, 0)
+	h := New(tc)
+	tc.Set("a", 1, cache.DefaultExpiration)
+	tc.Namespace("ns").Set("a", 1, cache.DefaultExpiration)
+
+	var stats map[string]int
+	decodeBody(t, do(t, h, "GET", "/stats", ""), &stats)
+	if stats["items"] != 1 || stats["expired"] != 0 {
+		t.Error("Unexpected stats:", stats)
+	}
+}
+
+type point struct{ X, Y int }
+
+func TestEncoderDecoder(t *testing.T) {
+	tc := cache.New(cache.DefaultExpiration, 0)
+	h := New(tc)
+	h.SetDecoder(func(r *http.Request, body []byte) (interface{}, error) {
+		var p point
+		err := json.Unmarshal(body, &p)
+		return p, err
+	})
+	h.SetEncoder(func(x interface{}) (interface{}, error) {
+		p, ok := x.(point)
+		if !ok {
+			return nil, errors.New("not a point")
+		}
+		return []int{p.X, p.Y}, nil
+	})
+
+	do(t, h, "PUT", "/keys/p", `{"X":1,"Y":2}`)
+	if x, _ := tc.Get("p"); x != (point{1, 2}) {
+		t.Error("p is not the decoded point:", x)
+	}
+	var it struct{ Value []int }
+	decodeBody(t, do(t, h, "GET", "/keys/p", ""), &it)
+	if len(it.Value) != 2 || it.Value[1] != 2 {
+		t.Error("Unexpected encoded value:", it.Value)
+	}
+
+	tc.Set("s", "str", cache.DefaultExpiration)
+	if w := do(t, h, "GET", "/keys/s", ""); w.Code != http.StatusInternalServerError {
+		t.Error("GET with a failing encoder returned", w.Code)
+	}
+}
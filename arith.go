@@ -0,0 +1,186 @@
+package cache
+
+import "math"
+
+const (
+	maxInt     = int64(^uint(0) >> 1)
+	minInt     = -maxInt - 1
+	maxUint    = uint64(^uint(0))
+	maxUintptr = uint64(^uintptr(0))
+)
+
+// Increment an item of any of the types handled by Increment by n, and
+// return its new value, which has the item's type, e.g. int8 for an int8
+// item. Returns an error wrapping ErrOverflow, and leaves the item unchanged,
+// if the result would not fit in the item's type.
+func (c *cache) IncrementChecked(k string, n int64) (interface{}, error) {
+	return c.add(k, n, false, false)
+}
+
+// Decrement an item of any of the types handled by Decrement by n, and
+// return its new value, which has the item's type. Returns an error wrapping
+// ErrOverflow, and leaves the item unchanged, if the result would not fit in
+// the item's type.
+func (c *cache) DecrementChecked(k string, n int64) (interface{}, error) {
+	return c.add(k, n, true, false)
+}
+
+// Increment an item of any of the types handled by Increment by n, clamping
+// the result to the maximum or minimum value of the item's type instead of
+// wrapping around, and return its new value, which has the item's type.
+func (c *cache) IncrementSaturating(k string, n int64) (interface{}, error) {
+	return c.add(k, n, false, true)
+}
+
+// Decrement an item of any of the types handled by Decrement by n, clamping
+// the result to the maximum or minimum value of the item's type instead of
+// wrapping around, and return its new value, which has the item's type.
+func (c *cache) DecrementSaturating(k string, n int64) (interface{}, error) {
+	return c.add(k, n, true, true)
+}
+
+func (c *cache) add(k string, n int64, sub, saturate bool) (interface{}, error) {
+	defer c.lockKey(k)()
+
+	item, found := c.items.Load(k)
+	if !found || item.(Item).Expired() {
+		return nil, notFoundError(k)
+	}
+	v := item.(Item)
+	var overflow int
+	switch x := v.Object.(type) {
+	case int:
+		var r int64
+		r, overflow = addSigned(int64(x), n, sub, minInt, maxInt)
+		v.Object = int(r)
+	case int8:
+		var r int64
+		r, overflow = addSigned(int64(x), n, sub, math.MinInt8, math.MaxInt8)
+		v.Object = int8(r)
+	case int16:
+		var r int64
+		r, overflow = addSigned(int64(x), n, sub, math.MinInt16, math.MaxInt16)
+		v.Object = int16(r)
+	case int32:
+		var r int64
+		r, overflow = addSigned(int64(x), n, sub, math.MinInt32, math.MaxInt32)
+		v.Object = int32(r)
+	case int64:
+		var r int64
+		r, overflow = addSigned(x, n, sub, math.MinInt64, math.MaxInt64)
+		v.Object = r
+	case uint:
+		var r uint64
+		r, overflow = addUnsigned(uint64(x), n, sub, maxUint)
+		v.Object = uint(r)
+	case uintptr:
+		var r uint64
+		r, overflow = addUnsigned(uint64(x), n, sub, maxUintptr)
+		v.Object = uintptr(r)
+	case uint8:
+		var r uint64
+		r, overflow = addUnsigned(uint64(x), n, sub, math.MaxUint8)
+		v.Object = uint8(r)
+	case uint16:
+		var r uint64
+		r, overflow = addUnsigned(uint64(x), n, sub, math.MaxUint16)
+		v.Object = uint16(r)
+	case uint32:
+		var r uint64
+		r, overflow = addUnsigned(uint64(x), n, sub, math.MaxUint32)
+		v.Object = uint32(r)
+	case uint64:
+		var r uint64
+		r, overflow = addUnsigned(x, n, sub, math.MaxUint64)
+		v.Object = r
+	case float32:
+		var r float64
+		r, overflow = addFloat(float64(x), n, sub, math.MaxFloat32)
+		v.Object = float32(r)
+	case float64:
+		var r float64
+		r, overflow = addFloat(x, n, sub, math.MaxFloat64)
+		v.Object = r
+	default:
+		return nil, typeMismatchError(k, "an integer")
+	}
+	if overflow != 0 && !saturate {
+		return nil, overflowError(k)
+	}
+	c.safeStore(k, v)
+	return v.Object, nil
+}
+
+// addSigned returns v+n, or v-n if sub is true, clamped to [min, max]. The
+// second result is 1 if the exact result is above max, -1 if it is below min,
+// and 0 otherwise.
+func addSigned(v, n int64, sub bool, min, max int64) (int64, int) {
+	if sub {
+		if n == math.MinInt64 {
+			// -n doesn't fit in an int64, but v-n does when v is negative
+			if v >= 0 {
+				return max, 1
+			}
+			return clampSigned(v-n, min, max)
+		}
+		n = -n
+	}
+	r := v + n
+	if n > 0 && r < v {
+		return max, 1
+	}
+	if n < 0 && r > v {
+		return min, -1
+	}
+	return clampSigned(r, min, max)
+}
+
+func clampSigned(r, min, max int64) (int64, int) {
+	if r > max {
+		return max, 1
+	}
+	if r < min {
+		return min, -1
+	}
+	return r, 0
+}
+
+// addUnsigned is like addSigned for unsigned types, whose minimum is 0.
+func addUnsigned(v uint64, n int64, sub bool, max uint64) (uint64, int) {
+	// uint64(-n) is also correct for math.MinInt64
+	mag := uint64(n)
+	if n < 0 {
+		mag = uint64(-n)
+	}
+	if (n >= 0) != sub {
+		r := v + mag
+		if r < v || r > max {
+			return max, 1
+		}
+		return r, 0
+	}
+	if mag > v {
+		return 0, -1
+	}
+	return v - mag, 0
+}
+
+// addFloat is like addSigned for floating point types whose largest finite
+// value is max. Items that are already infinite are not considered to
+// overflow.
+func addFloat(v float64, n int64, sub bool, max float64) (float64, int) {
+	r := v + float64(n)
+	if sub {
+		r = v - float64(n)
+	}
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return r, 0
+	}
+	if r > max {
+		return max, 1
+	}
+	if r < -max {
+		return -max, -1
+	}
+	return r, 0
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestIncrementChecked(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		n     int64
+		want  interface{}
+	}{
+		{"int", int(maxInt), 1, nil},
+		{"int8", int8(127), 1, nil},
+		{"int8", int8(126), 1, int8(127)},
+		{"int8", int8(0), 1000, nil},
+		{"int16", int16(math.MaxInt16), 1, nil},
+		{"int32", int32(math.MaxInt32), 1, nil},
+		{"int64", int64(math.MaxInt64), 1, nil},
+		{"int64", int64(math.MinInt64), -1, nil},
+		{"int64", int64(0), math.MinInt64, int64(math.MinInt64)},
+		{"uint", uint(maxUint), 1, nil},
+		{"uintptr", uintptr(maxUintptr), 1, nil},
+		{"uint8", uint8(255), 1, nil},
+		{"uint8", uint8(0), -1, nil},
+		{"uint8", uint8(5), -5, uint8(0)},
+		{"uint16", uint16(math.MaxUint16), 1, nil},
+		{"uint32", uint32(math.MaxUint32), 1, nil},
+		{"uint64", uint64(math.MaxUint64), 1, nil},
+		{"uint64", uint64(1), math.MinInt64, nil},
+		{"float32", float32(1.5), -2, float32(-0.5)},
+		{"float64", float64(1.5), 1, float64(2.5)},
+	}
+	for _, tt := range tests {
+		tc := New(DefaultExpiration, 0)
+		tc.Set(tt.name, tt.value, DefaultExpiration)
+		r, err := tc.IncrementChecked(tt.name, tt.n)
+		x, _ := tc.Get(tt.name)
+		if tt.want == nil {
+			if !errors.Is(err, ErrOverflow) {
+				t.Errorf("IncrementChecked(%v %T, %d) returned %v, expected ErrOverflow", tt.value, tt.value, tt.n, err)
+			}
+			if x != tt.value {
+				t.Errorf("IncrementChecked(%v %T, %d) modified the item: %v", tt.value, tt.value, tt.n, x)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("IncrementChecked(%v %T, %d) returned %v", tt.value, tt.value, tt.n, err)
+		}
+		if x != tt.want || r != tt.want {
+			t.Errorf("IncrementChecked(%v %T, %d) = %v, stored %v, want %v", tt.value, tt.value, tt.n, r, x, tt.want)
+		}
+	}
+}
+
+func TestDecrementChecked(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("uint8", uint8(0), DefaultExpiration)
+	if _, err := tc.DecrementChecked("uint8", 1); !errors.Is(err, ErrOverflow) {
+		t.Error("Decrementing uint8 0 did not return ErrOverflow:", err)
+	}
+	tc.Set("int64", int64(-1), DefaultExpiration)
+	if r, err := tc.DecrementChecked("int64", math.MinInt64); err != nil || r != int64(math.MaxInt64) {
+		t.Error("Error decrementing int64:", r, err)
+	}
+	if x, _ := tc.Get("int64"); x.(int64) != math.MaxInt64 {
+		t.Error("int64 is not MaxInt64:", x)
+	}
+	tc.Set("int64", int64(0), DefaultExpiration)
+	if _, err := tc.DecrementChecked("int64", math.MinInt64); !errors.Is(err, ErrOverflow) {
+		t.Error("Decrementing int64 0 by MinInt64 did not return ErrOverflow:", err)
+	}
+	if _, err := tc.DecrementChecked("missing", 1); err == nil {
+		t.Error("Decremented a missing item")
+	}
+	tc.Set("string", "foo", DefaultExpiration)
+	if _, err := tc.DecrementChecked("string", 1); err == nil {
+		t.Error("Decremented a string")
+	}
+}
+
+func TestSaturating(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		n     int64
+		sub   bool
+		want  interface{}
+	}{
+		{int8(127), 1, false, int8(127)},
+		{int8(-128), 1, true, int8(-128)},
+		{int8(0), 1000, false, int8(127)},
+		{int(maxInt), 1, false, int(maxInt)},
+		{int16(math.MinInt16), 1, true, int16(math.MinInt16)},
+		{int32(math.MaxInt32), 1, false, int32(math.MaxInt32)},
+		{int64(math.MinInt64), 5, true, int64(math.MinInt64)},
+		{uint(0), 1, true, uint(0)},
+		{uintptr(maxUintptr), 1, false, uintptr(maxUintptr)},
+		{uint8(255), 1, false, uint8(255)},
+		{uint8(3), 5, true, uint8(0)},
+		{uint16(math.MaxUint16), 1, false, uint16(math.MaxUint16)},
+		{uint32(0), 1, true, uint32(0)},
+		{uint64(math.MaxUint64), 1, false, uint64(math.MaxUint64)},
+		{float32(2), 1, true, float32(1)},
+		{float64(1), 1, true, float64(0)},
+	}
+	for _, tt := range tests {
+		tc := New(DefaultExpiration, 0)
+		tc.Set("n", tt.value, DefaultExpiration)
+		var (
+			r   interface{}
+			err error
+		)
+		if tt.sub {
+			r, err = tc.DecrementSaturating("n", tt.n)
+		} else {
+			r, err = tc.IncrementSaturating("n", tt.n)
+		}
+		if err != nil || r != tt.want {
+			t.Errorf("Saturating arithmetic on %v %T returned %v, %v", tt.value, tt.value, r, err)
+		}
+		if x, _ := tc.Get("n"); x != tt.want {
+			t.Errorf("Saturating arithmetic on %v %T by %d (sub %v) = %v, want %v", tt.value, tt.value, tt.n, tt.sub, x, tt.want)
+		}
+	}
+}
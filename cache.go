@@ -1,8 +1,8 @@
 package cache
 
 import (
-	"fmt"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,6 +12,10 @@ import (
 type Item struct {
 	Object     interface{}
 	Expiration int64
+	// Version is taken from a cache-wide counter every time the item is
+	// written, so it changes whenever the item is modified. See
+	// CompareAndSwap.
+	Version uint64
 }
 
 // Returns true if the item has expired.
@@ -41,22 +45,69 @@ type cache struct {
 	items             sync.Map
 	counter           atomic.Uint32
 	onEvicted         func(string, interface{})
+	onLeaseExpired    func(string, string)
 	janitor           *janitor
+	tags              tagIndex
+	namespaces        sync.Map
+	version           atomic.Uint64
+	keyLocks          [keyLockCount]sync.Mutex
+	loads             sync.Map // key -> *loadCall, for GetOrLoad
 }
 
-func (c *cache) safeStore(key, value interface{}) {
-	c.items.Store(key, value)
-	c.counter.Inc()
+// keyLockCount is the number of mutexes that writers are striped across.
+// Reads never take these locks.
+const keyLockCount = 256
+
+// keyLockIndex returns the index of the mutex in keyLocks guarding writes to k.
+func keyLockIndex(k string) int {
+	// Inlined FNV-1a, to avoid allocating a hash.Hash on every write
+	h := uint32(2166136261)
+	for i := 0; i < len(k); i++ {
+		h ^= uint32(k[i])
+		h *= 16777619
+	}
+	return int(h % keyLockCount)
+}
+
+// lockKey locks the mutex guarding writes to k and returns the function that
+// unlocks it, so that writers can simply defer c.lockKey(k)().
+func (c *cache) lockKey(k string) func() {
+	mu := &c.keyLocks[keyLockIndex(k)]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// The map's keys are strings, or namespaceKeys for the items of namespaces.
+func (c *cache) safeStore(key interface{}, item Item) {
+	c.safeSwap(key, item)
+}
+func (c *cache) safeSwap(key interface{}, item Item) (Item, bool) {
+	item.Version = c.version.Inc()
+	previous, loaded := c.items.Swap(key, item)
+	if !loaded {
+		c.counter.Inc()
+		return Item{}, false
+	}
+	return previous.(Item), true
 }
-func (c *cache) safeDelete(key interface{}) {
-	c.items.Delete(key)
+func (c *cache) safeDelete(key interface{}) (Item, bool) {
+	previous, loaded := c.items.LoadAndDelete(key)
+	if !loaded {
+		return Item{}, false
+	}
 	c.counter.Dec()
+	if k, ok := key.(string); ok {
+		c.tags.remove(k)
+	}
+	return previous.(Item), true
 }
 
 // Add an item to the cache, replacing any existing item. If the duration is 0
 // (DefaultExpiration), the cache's default expiration time is used. If it is -1
 // (NoExpiration), the item never expires.
 func (c *cache) Set(k string, x interface{}, d time.Duration) {
+	defer c.lockKey(k)()
+
 	// "Inlining" of set
 	var e int64
 	if d == DefaultExpiration {
@@ -70,9 +121,11 @@ func (c *cache) Set(k string, x interface{}, d time.Duration) {
 		Object:     x,
 		Expiration: e,
 	})
+	c.tags.remove(k)
 
 }
 
+// set stores an item without taking the key's lock; the caller must hold it.
 func (c *cache) set(k string, x interface{}, d time.Duration) {
 	var e int64
 	if d == DefaultExpiration {
@@ -85,6 +138,7 @@ func (c *cache) set(k string, x interface{}, d time.Duration) {
 		Object:     x,
 		Expiration: e,
 	})
+	c.tags.remove(k)
 
 }
 
@@ -95,13 +149,16 @@ func (c *cache) SetDefault(k string, x interface{}) {
 }
 
 // Add an item to the cache only if an item doesn't already exist for the given
-// key, or if the existing item has expired. Returns an error otherwise.
+// key, or if the existing item has expired. Returns an error wrapping ErrExists
+// otherwise.
 func (c *cache) Add(k string, x interface{}, d time.Duration) error {
 
+	defer c.lockKey(k)()
+
 	_, found := c.get(k)
 	if found {
 
-		return fmt.Errorf("Item %s already exists", k)
+		return existsError(k)
 	}
 	c.set(k, x, d)
 
@@ -109,19 +166,124 @@ func (c *cache) Add(k string, x interface{}, d time.Duration) error {
 }
 
 // Set a new value for the cache key only if it already exists, and the existing
-// item hasn't expired. Returns an error otherwise.
+// item hasn't expired. Returns an error wrapping ErrNotFound otherwise.
 func (c *cache) Replace(k string, x interface{}, d time.Duration) error {
 
+	defer c.lockKey(k)()
+
 	_, found := c.get(k)
 	if !found {
 
-		return fmt.Errorf("Item %s doesn't exist", k)
+		return notFoundError(k)
 	}
 	c.set(k, x, d)
 
 	return nil
 }
 
+// Append x, a string or []byte, to the value of an existing string or []byte
+// item. The item keeps its type and expiration. Returns an error wrapping
+// ErrNotFound if the item doesn't exist or has expired, or ErrTypeMismatch if
+// either the item or x is of another type.
+func (c *cache) Append(k string, x interface{}) error {
+	return c.concat(k, x, false)
+}
+
+// Prepend x, a string or []byte, to the value of an existing string or []byte
+// item. See Append.
+func (c *cache) Prepend(k string, x interface{}) error {
+	return c.concat(k, x, true)
+}
+
+func (c *cache) concat(k string, x interface{}, prepend bool) error {
+	var b []byte
+	switch x := x.(type) {
+	case string:
+		b = []byte(x)
+	case []byte:
+		b = x
+	default:
+		return typeMismatchError(k, "string or []byte argument")
+	}
+
+	defer c.lockKey(k)()
+
+	item, found := c.items.Load(k)
+	if !found || item.(Item).Expired() {
+
+		return notFoundError(k)
+	}
+	v := item.(Item)
+	var old []byte
+	switch o := v.Object.(type) {
+	case string:
+		old = []byte(o)
+	case []byte:
+		old = o
+	default:
+
+		return typeMismatchError(k, "string or []byte")
+	}
+	// Always copy, since the old slice may still be in use by readers
+	nb := make([]byte, 0, len(old)+len(b))
+	if prepend {
+		nb = append(append(nb, b...), old...)
+	} else {
+		nb = append(append(nb, old...), b...)
+	}
+	if _, ok := v.Object.(string); ok {
+		v.Object = string(nb)
+	} else {
+		v.Object = nb
+	}
+	c.safeStore(k, v)
+
+	return nil
+}
+
+// Delete an item from the cache and return it, calling OnEvicted as Delete
+// does. Returns the item or nil, and a bool indicating whether the key was
+// found. An expired item is deleted but not returned.
+func (c *cache) GetAndDelete(k string) (interface{}, bool) {
+
+	unlock := c.lockKey(k)
+	v, found := c.safeDelete(k)
+	unlock()
+
+	if !found {
+
+		return nil, false
+	}
+	if c.onEvicted != nil {
+		c.onEvicted(k, v.Object)
+	}
+	if v.Expired() {
+
+		return nil, false
+	}
+
+	return v.Object, true
+}
+
+// Add an item to the cache, replacing any existing item (see Set), and return
+// the item it replaced. Returns the previous item or nil, and a bool
+// indicating whether there was an unexpired one.
+func (c *cache) GetAndSet(k string, x interface{}, d time.Duration) (interface{}, bool) {
+	defer c.lockKey(k)()
+
+	v, found := c.safeSwap(k, Item{
+		Object:     x,
+		Expiration: c.expiration(d),
+	})
+	c.tags.remove(k)
+	if !found || v.Expired() {
+
+		return nil, false
+	}
+
+	return v.Object, true
+}
+
 // Get an item from the cache. Returns the item or nil, and a bool indicating
 // whether the key was found.
 func (c *cache) Get(k string) (interface{}, bool) {
@@ -174,6 +336,42 @@ func (c *cache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
 	return item.(Item).Object, time.Time{}, true
 }
 
+// GetWithVersion returns an item and its version from the cache. It returns
+// the item or nil, the version (see Item.Version), and a bool indicating
+// whether the key was found. Pass the version to CompareAndSwap to update the
+// item only if it hasn't been modified in the meantime.
+func (c *cache) GetWithVersion(k string) (interface{}, uint64, bool) {
+
+	item, found := c.items.Load(k)
+	if !found || item.(Item).Expired() {
+
+		return nil, 0, false
+	}
+
+	return item.(Item).Object, item.(Item).Version, true
+}
+
+// Set a new value for the cache key only if its version still equals version,
+// i.e. if nobody has written it since it was read with GetWithVersion. Returns
+// true if the value was stored, false if the item has been modified, and an
+// error wrapping ErrNotFound if the item doesn't exist or has expired. See Set for the meaning of d.
+func (c *cache) CompareAndSwap(k string, version uint64, x interface{}, d time.Duration) (bool, error) {
+	defer c.lockKey(k)()
+
+	item, found := c.items.Load(k)
+	if !found || item.(Item).Expired() {
+
+		return false, notFoundError(k)
+	}
+	if item.(Item).Version != version {
+
+		return false, nil
+	}
+	c.set(k, x, d)
+
+	return true, nil
+}
+
 func (c *cache) get(k string) (interface{}, bool) {
 	item, found := c.items.Load(k)
 	if !found {
@@ -195,10 +393,12 @@ func (c *cache) get(k string) (interface{}, bool) {
 // of the specialized methods, e.g. IncrementInt64.
 func (c *cache) Increment(k string, n int64) error {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return fmt.Errorf("Item %s not found", k)
+		return notFoundError(k)
 	}
 	v := item.(Item)
 	switch v.Object.(type) {
@@ -230,7 +430,7 @@ func (c *cache) Increment(k string, n int64) error {
 		v.Object = v.Object.(float64) + float64(n)
 	default:
 
-		return fmt.Errorf("The value for %s is not an integer", k)
+		return typeMismatchError(k, "an integer")
 	}
 	c.safeStore(k, v)
 
@@ -244,10 +444,12 @@ func (c *cache) Increment(k string, n int64) error {
 // e.g. IncrementFloat64.
 func (c *cache) IncrementFloat(k string, n float64) error {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return fmt.Errorf("Item %s not found", k)
+		return notFoundError(k)
 	}
 	v := item.(Item)
 	switch v.Object.(type) {
@@ -257,7 +459,7 @@ func (c *cache) IncrementFloat(k string, n float64) error {
 		v.Object = v.Object.(float64) + n
 	default:
 
-		return fmt.Errorf("The value for %s does not have type float32 or float64", k)
+		return typeMismatchError(k, "float32 or float64")
 	}
 	c.safeStore(k, v)
 
@@ -269,16 +471,18 @@ func (c *cache) IncrementFloat(k string, n float64) error {
 // value is returned.
 func (c *cache) IncrementInt(k string, n int) (int, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(int)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an int", k)
+		return 0, typeMismatchError(k, "int")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -292,16 +496,18 @@ func (c *cache) IncrementInt(k string, n int) (int, error) {
 // value is returned.
 func (c *cache) IncrementInt8(k string, n int8) (int8, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(int8)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an int8", k)
+		return 0, typeMismatchError(k, "int8")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -315,16 +521,18 @@ func (c *cache) IncrementInt8(k string, n int8) (int8, error) {
 // value is returned.
 func (c *cache) IncrementInt16(k string, n int16) (int16, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(int16)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an int16", k)
+		return 0, typeMismatchError(k, "int16")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -338,16 +546,18 @@ func (c *cache) IncrementInt16(k string, n int16) (int16, error) {
 // value is returned.
 func (c *cache) IncrementInt32(k string, n int32) (int32, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(int32)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an int32", k)
+		return 0, typeMismatchError(k, "int32")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -361,16 +571,18 @@ func (c *cache) IncrementInt32(k string, n int32) (int32, error) {
 // value is returned.
 func (c *cache) IncrementInt64(k string, n int64) (int64, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(int64)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an int64", k)
+		return 0, typeMismatchError(k, "int64")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -384,16 +596,18 @@ func (c *cache) IncrementInt64(k string, n int64) (int64, error) {
 // value is returned.
 func (c *cache) IncrementUint(k string, n uint) (uint, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uint)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uint", k)
+		return 0, typeMismatchError(k, "uint")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -407,16 +621,18 @@ func (c *cache) IncrementUint(k string, n uint) (uint, error) {
 // incremented value is returned.
 func (c *cache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uintptr)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uintptr", k)
+		return 0, typeMismatchError(k, "uintptr")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -430,16 +646,18 @@ func (c *cache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
 // incremented value is returned.
 func (c *cache) IncrementUint8(k string, n uint8) (uint8, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uint8)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uint8", k)
+		return 0, typeMismatchError(k, "uint8")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -453,16 +671,18 @@ func (c *cache) IncrementUint8(k string, n uint8) (uint8, error) {
 // incremented value is returned.
 func (c *cache) IncrementUint16(k string, n uint16) (uint16, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uint16)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uint16", k)
+		return 0, typeMismatchError(k, "uint16")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -476,16 +696,18 @@ func (c *cache) IncrementUint16(k string, n uint16) (uint16, error) {
 // incremented value is returned.
 func (c *cache) IncrementUint32(k string, n uint32) (uint32, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uint32)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uint32", k)
+		return 0, typeMismatchError(k, "uint32")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -499,16 +721,18 @@ func (c *cache) IncrementUint32(k string, n uint32) (uint32, error) {
 // incremented value is returned.
 func (c *cache) IncrementUint64(k string, n uint64) (uint64, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uint64)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uint64", k)
+		return 0, typeMismatchError(k, "uint64")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -522,16 +746,18 @@ func (c *cache) IncrementUint64(k string, n uint64) (uint64, error) {
 // incremented value is returned.
 func (c *cache) IncrementFloat32(k string, n float32) (float32, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(float32)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an float32", k)
+		return 0, typeMismatchError(k, "float32")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -545,16 +771,18 @@ func (c *cache) IncrementFloat32(k string, n float32) (float32, error) {
 // incremented value is returned.
 func (c *cache) IncrementFloat64(k string, n float64) (float64, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(float64)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an float64", k)
+		return 0, typeMismatchError(k, "float64")
 	}
 	nv := rv + n
 	v.Object = nv
@@ -563,6 +791,99 @@ func (c *cache) IncrementFloat64(k string, n float64) (float64, error) {
 	return nv, nil
 }
 
+// Increment an item of type int64 by n, or set it to initial with the
+// expiration duration d if it doesn't exist or has expired. If resetTTL is
+// true, an existing item's expiration is also reset to d. Returns an error if
+// the item's value is not an int64. If there is no error, the new value is
+// returned.
+func (c *cache) IncrementInt64OrSet(k string, n, initial int64, d time.Duration, resetTTL bool) (int64, error) {
+
+	defer c.lockKey(k)()
+
+	item, found := c.items.Load(k)
+	if !found || item.(Item).Expired() {
+		c.set(k, initial, d)
+
+		return initial, nil
+	}
+	v := item.(Item)
+	rv, ok := v.Object.(int64)
+	if !ok {
+
+		return 0, typeMismatchError(k, "int64")
+	}
+	nv := rv + n
+	v.Object = nv
+	if resetTTL {
+		v.Expiration = c.expiration(d)
+	}
+	c.safeStore(k, v)
+
+	return nv, nil
+}
+
+// Increment an item of type uint64 by n, or set it to initial with the
+// expiration duration d if it doesn't exist or has expired. If resetTTL is
+// true, an existing item's expiration is also reset to d. Returns an error if
+// the item's value is not an uint64. If there is no error, the new value is
+// returned.
+func (c *cache) IncrementUint64OrSet(k string, n, initial uint64, d time.Duration, resetTTL bool) (uint64, error) {
+
+	defer c.lockKey(k)()
+
+	item, found := c.items.Load(k)
+	if !found || item.(Item).Expired() {
+		c.set(k, initial, d)
+
+		return initial, nil
+	}
+	v := item.(Item)
+	rv, ok := v.Object.(uint64)
+	if !ok {
+
+		return 0, typeMismatchError(k, "uint64")
+	}
+	nv := rv + n
+	v.Object = nv
+	if resetTTL {
+		v.Expiration = c.expiration(d)
+	}
+	c.safeStore(k, v)
+
+	return nv, nil
+}
+
+// Increment an item of type float64 by n, or set it to initial with the
+// expiration duration d if it doesn't exist or has expired. If resetTTL is
+// true, an existing item's expiration is also reset to d. Returns an error if
+// the item's value is not an float64. If there is no error, the new value is
+// returned.
+func (c *cache) IncrementFloat64OrSet(k string, n, initial float64, d time.Duration, resetTTL bool) (float64, error) {
+
+	defer c.lockKey(k)()
+
+	item, found := c.items.Load(k)
+	if !found || item.(Item).Expired() {
+		c.set(k, initial, d)
+
+		return initial, nil
+	}
+	v := item.(Item)
+	rv, ok := v.Object.(float64)
+	if !ok {
+
+		return 0, typeMismatchError(k, "float64")
+	}
+	nv := rv + n
+	v.Object = nv
+	if resetTTL {
+		v.Expiration = c.expiration(d)
+	}
+	c.safeStore(k, v)
+
+	return nv, nil
+}
+
 // Decrement an item of type int, int8, int16, int32, int64, uintptr, uint,
 // uint8, uint32, or uint64, float32 or float64 by n. Returns an error if the
 // item's value is not an integer, if it was not found, or if it is not
@@ -572,10 +893,12 @@ func (c *cache) Decrement(k string, n int64) error {
 	// TODO: Implement Increment and Decrement more cleanly.
 	// (Cannot do Increment(k, n*-1) for uints.)
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return fmt.Errorf("Item not found")
+		return notFoundError(k)
 	}
 	v := item.(Item)
 	switch v.Object.(type) {
@@ -607,7 +930,7 @@ func (c *cache) Decrement(k string, n int64) error {
 		v.Object = v.Object.(float64) - float64(n)
 	default:
 
-		return fmt.Errorf("The value for %s is not an integer", k)
+		return typeMismatchError(k, "an integer")
 	}
 	c.safeStore(k, v)
 
@@ -621,10 +944,12 @@ func (c *cache) Decrement(k string, n int64) error {
 // e.g. DecrementFloat64.
 func (c *cache) DecrementFloat(k string, n float64) error {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return fmt.Errorf("Item %s not found", k)
+		return notFoundError(k)
 	}
 	v := item.(Item)
 	switch v.Object.(type) {
@@ -634,7 +959,7 @@ func (c *cache) DecrementFloat(k string, n float64) error {
 		v.Object = v.Object.(float64) - n
 	default:
 
-		return fmt.Errorf("The value for %s does not have type float32 or float64", k)
+		return typeMismatchError(k, "float32 or float64")
 	}
 	c.safeStore(k, v)
 
@@ -646,16 +971,18 @@ func (c *cache) DecrementFloat(k string, n float64) error {
 // value is returned.
 func (c *cache) DecrementInt(k string, n int) (int, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(int)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an int", k)
+		return 0, typeMismatchError(k, "int")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -669,16 +996,18 @@ func (c *cache) DecrementInt(k string, n int) (int, error) {
 // value is returned.
 func (c *cache) DecrementInt8(k string, n int8) (int8, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(int8)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an int8", k)
+		return 0, typeMismatchError(k, "int8")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -692,16 +1021,18 @@ func (c *cache) DecrementInt8(k string, n int8) (int8, error) {
 // value is returned.
 func (c *cache) DecrementInt16(k string, n int16) (int16, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(int16)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an int16", k)
+		return 0, typeMismatchError(k, "int16")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -715,16 +1046,18 @@ func (c *cache) DecrementInt16(k string, n int16) (int16, error) {
 // value is returned.
 func (c *cache) DecrementInt32(k string, n int32) (int32, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(int32)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an int32", k)
+		return 0, typeMismatchError(k, "int32")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -738,16 +1071,18 @@ func (c *cache) DecrementInt32(k string, n int32) (int32, error) {
 // value is returned.
 func (c *cache) DecrementInt64(k string, n int64) (int64, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(int64)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an int64", k)
+		return 0, typeMismatchError(k, "int64")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -761,16 +1096,18 @@ func (c *cache) DecrementInt64(k string, n int64) (int64, error) {
 // value is returned.
 func (c *cache) DecrementUint(k string, n uint) (uint, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uint)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uint", k)
+		return 0, typeMismatchError(k, "uint")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -784,16 +1121,18 @@ func (c *cache) DecrementUint(k string, n uint) (uint, error) {
 // decremented value is returned.
 func (c *cache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uintptr)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uintptr", k)
+		return 0, typeMismatchError(k, "uintptr")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -807,16 +1146,18 @@ func (c *cache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
 // value is returned.
 func (c *cache) DecrementUint8(k string, n uint8) (uint8, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uint8)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uint8", k)
+		return 0, typeMismatchError(k, "uint8")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -830,16 +1171,18 @@ func (c *cache) DecrementUint8(k string, n uint8) (uint8, error) {
 // decremented value is returned.
 func (c *cache) DecrementUint16(k string, n uint16) (uint16, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uint16)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uint16", k)
+		return 0, typeMismatchError(k, "uint16")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -853,16 +1196,18 @@ func (c *cache) DecrementUint16(k string, n uint16) (uint16, error) {
 // decremented value is returned.
 func (c *cache) DecrementUint32(k string, n uint32) (uint32, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uint32)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uint32", k)
+		return 0, typeMismatchError(k, "uint32")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -876,16 +1221,18 @@ func (c *cache) DecrementUint32(k string, n uint32) (uint32, error) {
 // decremented value is returned.
 func (c *cache) DecrementUint64(k string, n uint64) (uint64, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(uint64)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an uint64", k)
+		return 0, typeMismatchError(k, "uint64")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -899,16 +1246,18 @@ func (c *cache) DecrementUint64(k string, n uint64) (uint64, error) {
 // decremented value is returned.
 func (c *cache) DecrementFloat32(k string, n float32) (float32, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(float32)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an float32", k)
+		return 0, typeMismatchError(k, "float32")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -922,16 +1271,18 @@ func (c *cache) DecrementFloat32(k string, n float32) (float32, error) {
 // decremented value is returned.
 func (c *cache) DecrementFloat64(k string, n float64) (float64, error) {
 
+	defer c.lockKey(k)()
+
 	item, found := c.items.Load(k)
 	if !found || item.(Item).Expired() {
 
-		return 0, fmt.Errorf("Item %s not found", k)
+		return 0, notFoundError(k)
 	}
 	v := item.(Item)
 	rv, ok := v.Object.(float64)
 	if !ok {
 
-		return 0, fmt.Errorf("The value for %s is not an float64", k)
+		return 0, typeMismatchError(k, "float64")
 	}
 	nv := rv - n
 	v.Object = nv
@@ -943,21 +1294,23 @@ func (c *cache) DecrementFloat64(k string, n float64) (float64, error) {
 // Delete an item from the cache. Does nothing if the key is not in the cache.
 func (c *cache) Delete(k string) {
 
+	unlock := c.lockKey(k)
 	v, evicted := c.delete(k)
+	unlock()
 
 	if evicted {
 		c.onEvicted(k, v)
 	}
 }
 
-func (c *cache) delete(k string) (interface{}, bool) {
-	if c.onEvicted != nil {
-		if v, found := c.items.Load(k); found {
-			c.safeDelete(k)
-			return v.(Item).Object, true
-		}
+// delete removes an item without taking the key's lock; the caller must hold
+// it. The returned bool reports whether onEvicted should be called with the
+// returned value once the lock has been released.
+func (c *cache) delete(k interface{}) (interface{}, bool) {
+	v, found := c.safeDelete(k)
+	if found && c.onEvicted != nil {
+		return v.Object, true
 	}
-	c.safeDelete(k)
 	return nil, false
 }
 
@@ -966,24 +1319,90 @@ type keyAndValue struct {
 	value interface{}
 }
 
-// Delete all expired items from the cache.
+// Delete all expired items from the cache, along with items left behind by
+// Namespace.InvalidateAll.
 func (c *cache) DeleteExpired() {
-	var evictedItems []keyAndValue
+	var evictedItems, lapsedLeases []keyAndValue
 	now := time.Now().UnixNano()
 
+	expired := func(k interface{}, item Item) bool {
+		if item.Expiration > 0 && now > item.Expiration {
+			return true
+		}
+		nk, ok := k.(namespaceKey)
+		return ok && nk.stale()
+	}
+
 	c.items.Range(func(k, v interface{}) bool {
-		if v.(Item).Expiration > 0 && now > v.(Item).Expiration {
-			ov, evicted := c.delete(k.(string))
+		if !expired(k, v.(Item)) {
+			return true
+		}
+		unlock := c.lockItem(k)
+		// Check again now that writers are excluded, in case the item was
+		// replaced since Range loaded it
+		if v, found := c.items.Load(k); found && expired(k, v.(Item)) {
+			ov, evicted := c.delete(k)
 			if evicted {
-				evictedItems = append(evictedItems, keyAndValue{k.(string), ov})
+				evictedItems = append(evictedItems, keyAndValue{itemKey(k), ov})
+			}
+			if l, ok := v.(Item).Object.(Lease); ok && c.onLeaseExpired != nil {
+				lapsedLeases = append(lapsedLeases, keyAndValue{itemKey(k), l.Owner})
 			}
 		}
+		unlock()
 		return true
 	})
 
 	for _, v := range evictedItems {
 		c.onEvicted(v.key, v.value)
 	}
+	for _, v := range lapsedLeases {
+		c.onLeaseExpired(v.key, v.value.(string))
+	}
+}
+
+// Delete all items whose key starts with prefix. Returns the number of items
+// removed.
+func (c *cache) DeletePrefix(prefix string) int {
+	return c.deleteKeys(func(k string) bool {
+		return strings.HasPrefix(k, prefix)
+	})
+}
+
+// Delete all items whose key matches the Redis-style glob pattern (supporting
+// *, ?, [abc], [^abc], [a-z] and \ escapes). Returns the number of items
+// removed.
+func (c *cache) DeleteMatching(pattern string) int {
+	return c.deleteKeys(func(k string) bool {
+		return MatchGlob(pattern, k)
+	})
+}
+
+func (c *cache) deleteKeys(match func(k string) bool) int {
+	var evictedItems []keyAndValue
+	n := 0
+
+	c.items.Range(func(key, v interface{}) bool {
+		k, ok := key.(string)
+		if !ok || !match(k) {
+			return true
+		}
+		unlock := c.lockKey(k)
+		if _, found := c.items.Load(k); found {
+			ov, evicted := c.delete(k)
+			if evicted {
+				evictedItems = append(evictedItems, keyAndValue{k, ov})
+			}
+			n++
+		}
+		unlock()
+		return true
+	})
+
+	for _, v := range evictedItems {
+		c.onEvicted(v.key, v.value)
+	}
+	return n
 }
 
 // Sets an (optional) function that is called with the key and value when an
@@ -998,20 +1417,45 @@ func (c *cache) OnEvicted(f func(string, interface{})) {
 // Copies all unexpired items in the cache into a new map and returns it.
 func (c *cache) Items() map[string]Item {
 
-	var m map[string]Item
+	m := make(map[string]Item)
 
+	c.Range(func(k string, item Item) bool {
+		m[k] = item
+		return true
+	})
+
+	return m
+}
+
+// Calls f for each unexpired item in the cache, without copying the items. If
+// f returns false, Range stops the iteration. As with sync.Map, Range does not
+// block other operations on the cache, and items added or removed while it
+// runs may or may not be visited. Items in namespaces are not visited.
+func (c *cache) Range(f func(k string, item Item) bool) {
 	now := time.Now().UnixNano()
-	c.items.Range(func(k, v interface{}) bool {
+	c.items.Range(func(key, v interface{}) bool {
+		k, ok := key.(string)
+		if !ok {
+			return true
+		}
 		if v.(Item).Expiration > 0 {
 			if now > v.(Item).Expiration {
 				return true
 			}
 		}
-		m[k.(string)] = v.(Item)
-		return true
+		return f(k, v.(Item))
 	})
+}
 
-	return m
+// Returns the keys of all unexpired items in the cache, in no particular
+// order.
+func (c *cache) Keys() []string {
+	var keys []string
+	c.Range(func(k string, item Item) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
 }
 
 // Returns the number of items in the cache. This may include items that have
@@ -1020,13 +1464,37 @@ func (c *cache) ItemCount() uint32 {
 	return c.counter.Load()
 }
 
-// Delete all items from the cache.
+// Returns the number of unexpired items in the cache, and the number of items
+// that have expired but have not yet been cleaned up. Unlike ItemCount, this
+// counts the items in one pass over the cache, and doesn't include items in
+// namespaces.
+func (c *cache) ItemCounts() (live, expired int) {
+	now := time.Now().UnixNano()
+	c.items.Range(func(key, v interface{}) bool {
+		if _, ok := key.(string); !ok {
+			return true
+		}
+		if e := v.(Item).Expiration; e > 0 && now > e {
+			expired++
+		} else {
+			live++
+		}
+		return true
+	})
+	return live, expired
+}
+
+// Delete all items from the cache, including the items of namespaces.
 func (c *cache) Flush() {
 
 	delete := func(key interface{}, value interface{}) bool {
+		unlock := c.lockItem(key)
 		c.safeDelete(key)
+		unlock()
 		return true
 	}
+	// safeDelete drops each item's tags under its lock, so that the tags of
+	// items set while the cache is being flushed are kept
 	c.items.Range(delete)
 
 }
@@ -1,7 +1,9 @@
 package cache
 
 import (
+	"errors"
 	"runtime"
+	"sort"
 	"strconv"
 	"sync"
 	"testing"
@@ -1117,16 +1119,16 @@ func TestAdd(t *testing.T) {
 		t.Error("Couldn't add foo even though it shouldn't exist")
 	}
 	err = tc.Add("foo", "baz", DefaultExpiration)
-	if err == nil {
-		t.Error("Successfully added another foo when it should have returned an error")
+	if !errors.Is(err, ErrExists) {
+		t.Error("Successfully added another foo when it should have returned ErrExists:", err)
 	}
 }
 
 func TestReplace(t *testing.T) {
 	tc := New(DefaultExpiration, 0)
 	err := tc.Replace("foo", "bar", DefaultExpiration)
-	if err == nil {
-		t.Error("Replaced foo when it shouldn't exist")
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("Replaced foo when it shouldn't exist:", err)
 	}
 	tc.Set("foo", "bar", DefaultExpiration)
 	err = tc.Replace("foo", "bar", DefaultExpiration)
@@ -1158,6 +1160,17 @@ func TestItemCount(t *testing.T) {
 	}
 }
 
+func TestItemCounts(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("foo", "1", DefaultExpiration)
+	tc.Set("bar", "2", time.Millisecond)
+	tc.Namespace("ns").Set("baz", "3", DefaultExpiration)
+	<-time.After(5 * time.Millisecond)
+	if live, expired := tc.ItemCounts(); live != 1 || expired != 1 {
+		t.Errorf("Item counts are not 1 and 1: %d, %d", live, expired)
+	}
+}
+
 func TestFlush(t *testing.T) {
 	tc := New(DefaultExpiration, 0)
 	tc.Set("foo", "bar", DefaultExpiration)
@@ -1591,3 +1604,325 @@ func TestGetWithExpiration(t *testing.T) {
 		t.Error("expiration for e is in the past")
 	}
 }
+
+func TestDeletePrefix(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("user:1:profile", "a", DefaultExpiration)
+	tc.Set("user:1:settings", "b", DefaultExpiration)
+	tc.Set("user:12:profile", "c", DefaultExpiration)
+	tc.Set("order:1", "d", DefaultExpiration)
+
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	if n := tc.DeletePrefix("user:1:"); n != 2 {
+		t.Errorf("DeletePrefix removed %d items, expected 2", n)
+	}
+	if len(evicted) != 2 {
+		t.Errorf("OnEvicted was called %d times, expected 2", len(evicted))
+	}
+	if _, found := tc.Get("user:1:profile"); found {
+		t.Error("user:1:profile was found, but it should have been deleted")
+	}
+	if _, found := tc.Get("user:12:profile"); !found {
+		t.Error("user:12:profile was not found")
+	}
+	if _, found := tc.Get("order:1"); !found {
+		t.Error("order:1 was not found")
+	}
+}
+
+func TestDeleteMatching(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("user:1:profile", "a", DefaultExpiration)
+	tc.Set("user:2:profile", "b", DefaultExpiration)
+	tc.Set("user:2:settings", "c", DefaultExpiration)
+	tc.Set("user:10:profile", "d", DefaultExpiration)
+
+	if n := tc.DeleteMatching("user:?:profile"); n != 2 {
+		t.Errorf("DeleteMatching removed %d items, expected 2", n)
+	}
+	if _, found := tc.Get("user:10:profile"); !found {
+		t.Error("user:10:profile was not found")
+	}
+	if n := tc.DeleteMatching("user:*"); n != 2 {
+		t.Errorf("DeleteMatching removed %d items, expected 2", n)
+	}
+	if n := tc.DeleteMatching("*"); n != 0 {
+		t.Errorf("DeleteMatching removed %d items from an empty cache", n)
+	}
+}
+
+func TestItems(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	items := tc.Items()
+	if len(items) != 2 {
+		t.Errorf("Items returned %d items, expected 2", len(items))
+	}
+	if items["a"].Object.(int) != 1 {
+		t.Error("a is not 1:", items["a"].Object)
+	}
+}
+
+func TestRange(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+
+	sum := 0
+	tc.Range(func(k string, item Item) bool {
+		sum += item.Object.(int)
+		return true
+	})
+	if sum != 3 {
+		t.Error("Range visited unexpected items; sum:", sum)
+	}
+
+	visited := 0
+	tc.Range(func(k string, item Item) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("Range visited %d items after being stopped", visited)
+	}
+
+	keys := tc.Keys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Error("Keys returned unexpected keys:", keys)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if _, err := tc.CompareAndSwap("foo", 0, "bar", DefaultExpiration); err == nil {
+		t.Error("Swapped foo when it shouldn't exist")
+	}
+
+	tc.Set("foo", "bar", DefaultExpiration)
+	x, v1, found := tc.GetWithVersion("foo")
+	if !found || x.(string) != "bar" {
+		t.Fatal("foo was not found:", x)
+	}
+	swapped, err := tc.CompareAndSwap("foo", v1, "baz", DefaultExpiration)
+	if err != nil || !swapped {
+		t.Error("Couldn't swap foo with its current version:", err)
+	}
+	swapped, err = tc.CompareAndSwap("foo", v1, "qux", DefaultExpiration)
+	if err != nil || swapped {
+		t.Error("Swapped foo with a stale version:", err)
+	}
+	x, v2, _ := tc.GetWithVersion("foo")
+	if x.(string) != "baz" {
+		t.Error("foo is not baz:", x)
+	}
+	if v2 <= v1 {
+		t.Errorf("Version did not increase: %d -> %d", v1, v2)
+	}
+
+	if _, err := tc.IncrementInt("n", 1); err == nil {
+		t.Error("Incremented n when it shouldn't exist")
+	}
+	tc.Set("n", 1, DefaultExpiration)
+	_, v3, _ := tc.GetWithVersion("n")
+	tc.IncrementInt("n", 1)
+	if swapped, _ := tc.CompareAndSwap("n", v3, 10, DefaultExpiration); swapped {
+		t.Error("Swapped n after it was incremented")
+	}
+}
+
+func TestCompareAndSwapConcurrent(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("counter", 0, DefaultExpiration)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for {
+					x, v, _ := tc.GetWithVersion("counter")
+					if ok, _ := tc.CompareAndSwap("counter", v, x.(int)+1, DefaultExpiration); ok {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if x, _ := tc.Get("counter"); x.(int) != 800 {
+		t.Error("counter is not 800:", x)
+	}
+}
+
+func TestIncrementOrSet(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	n, err := tc.IncrementInt64OrSet("int64", 1, 10, NoExpiration, false)
+	if err != nil || n != 10 {
+		t.Error("IncrementInt64OrSet did not set int64 to 10:", n, err)
+	}
+	n, err = tc.IncrementInt64OrSet("int64", 1, 10, NoExpiration, false)
+	if err != nil || n != 11 {
+		t.Error("IncrementInt64OrSet did not increment int64 to 11:", n, err)
+	}
+
+	u, err := tc.IncrementUint64OrSet("uint64", 2, 1, NoExpiration, false)
+	if err != nil || u != 1 {
+		t.Error("IncrementUint64OrSet did not set uint64 to 1:", u, err)
+	}
+	u, _ = tc.IncrementUint64OrSet("uint64", 2, 1, NoExpiration, false)
+	if u != 3 {
+		t.Error("uint64 is not 3:", u)
+	}
+
+	f, err := tc.IncrementFloat64OrSet("float64", 0.5, 1.5, NoExpiration, false)
+	if err != nil || f != 1.5 {
+		t.Error("IncrementFloat64OrSet did not set float64 to 1.5:", f, err)
+	}
+	f, _ = tc.IncrementFloat64OrSet("float64", 0.5, 1.5, NoExpiration, false)
+	if f != 2 {
+		t.Error("float64 is not 2:", f)
+	}
+
+	tc.Set("string", "foo", DefaultExpiration)
+	if _, err := tc.IncrementInt64OrSet("string", 1, 0, NoExpiration, false); err == nil {
+		t.Error("Incremented a string")
+	}
+}
+
+func TestIncrementOrSetExpiration(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.IncrementInt64OrSet("a", 1, 1, 20*time.Millisecond, false)
+	_, e1, _ := tc.GetWithExpiration("a")
+	if e1.IsZero() {
+		t.Fatal("a was created without an expiration")
+	}
+	<-time.After(5 * time.Millisecond)
+	tc.IncrementInt64OrSet("a", 1, 1, 20*time.Millisecond, false)
+	_, e2, _ := tc.GetWithExpiration("a")
+	if !e2.Equal(e1) {
+		t.Error("Increment without resetTTL changed the expiration of a")
+	}
+	tc.IncrementInt64OrSet("a", 1, 1, 20*time.Millisecond, true)
+	_, e3, _ := tc.GetWithExpiration("a")
+	if !e3.After(e1) {
+		t.Error("Increment with resetTTL did not extend the expiration of a")
+	}
+
+	<-time.After(30 * time.Millisecond)
+	n, _ := tc.IncrementInt64OrSet("a", 1, 1, 20*time.Millisecond, false)
+	if n != 1 {
+		t.Error("a was not reset to 1 after expiring:", n)
+	}
+}
+
+func TestAppendPrepend(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("s", "b", 50*time.Millisecond)
+	tc.Set("b", []byte("b"), DefaultExpiration)
+	_, e1, _ := tc.GetWithExpiration("s")
+
+	if err := tc.Append("s", "c"); err != nil {
+		t.Error("Error appending to s:", err)
+	}
+	if err := tc.Prepend("s", []byte("a")); err != nil {
+		t.Error("Error prepending to s:", err)
+	}
+	x, e2, _ := tc.GetWithExpiration("s")
+	if x.(string) != "abc" {
+		t.Error("s is not abc:", x)
+	}
+	if !e1.Equal(e2) {
+		t.Error("Append changed the expiration of s")
+	}
+
+	old, _ := tc.Get("b")
+	tc.Append("b", []byte("c"))
+	tc.Prepend("b", "a")
+	if x, _ := tc.Get("b"); string(x.([]byte)) != "abc" {
+		t.Error("b is not abc:", x)
+	}
+	if string(old.([]byte)) != "b" {
+		t.Error("Append modified the previous value of b:", old)
+	}
+
+	if err := tc.Append("missing", "a"); !errors.Is(err, ErrNotFound) {
+		t.Error("Append to a missing item returned", err)
+	}
+	tc.Set("int", 1, DefaultExpiration)
+	if err := tc.Append("int", "a"); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("Append to an int returned", err)
+	}
+	if err := tc.Prepend("s", 1); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("Prepend of an int returned", err)
+	}
+}
+
+func TestGetAndDelete(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("token", "abc", DefaultExpiration)
+	x, found := tc.GetAndDelete("token")
+	if !found || x.(string) != "abc" {
+		t.Error("GetAndDelete did not return token:", x)
+	}
+	if _, found := tc.GetAndDelete("token"); found {
+		t.Error("GetAndDelete returned token twice")
+	}
+	if len(evicted) != 1 || evicted[0] != "token" {
+		t.Error("OnEvicted was not called once for token:", evicted)
+	}
+
+	tc.Set("expired", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	if _, found := tc.GetAndDelete("expired"); found {
+		t.Error("GetAndDelete returned an expired item")
+	}
+	if n := tc.ItemCount(); n != 0 {
+		t.Error("Item count is not 0:", n)
+	}
+}
+
+func TestGetAndSet(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if _, found := tc.GetAndSet("foo", "a", DefaultExpiration); found {
+		t.Error("GetAndSet found a previous foo")
+	}
+	x, found := tc.GetAndSet("foo", "b", DefaultExpiration)
+	if !found || x.(string) != "a" {
+		t.Error("GetAndSet did not return the previous foo:", x)
+	}
+	if x, _ := tc.Get("foo"); x.(string) != "b" {
+		t.Error("foo is not b:", x)
+	}
+	tc.Set("expired", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	if _, found := tc.GetAndSet("expired", 2, DefaultExpiration); found {
+		t.Error("GetAndSet returned an expired item")
+	}
+	if n := tc.ItemCount(); n != 2 {
+		t.Error("Item count is not 2:", n)
+	}
+}
+
+func TestItemCountOverwrite(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("foo", "1", DefaultExpiration)
+	tc.Set("foo", "2", DefaultExpiration)
+	tc.Delete("bar")
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("Item count is not 1: %d", n)
+	}
+}
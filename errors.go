@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// ErrNotFound is returned when an operation requires an item that
+	// doesn't exist or has expired.
+	ErrNotFound = errors.New("cache: item not found")
+	// ErrExists is returned by Add when the item already exists.
+	ErrExists = errors.New("cache: item already exists")
+	// ErrTypeMismatch is returned when an item's value doesn't have the type
+	// an operation requires.
+	ErrTypeMismatch = errors.New("cache: item has the wrong type")
+	// ErrOverflow is returned by the checked arithmetic methods when the
+	// result would not fit in the item's type.
+	ErrOverflow = errors.New("cache: arithmetic overflow")
+	// ErrNotOwner is returned when a lease is renewed or released by someone
+	// other than its current owner.
+	ErrNotOwner = errors.New("cache: lease is held by another owner")
+	// ErrTxnConflict is returned by Txn when a transaction could not be
+	// committed because the items it read kept being modified by other
+	// writers.
+	ErrTxnConflict = errors.New("cache: transaction conflict")
+	// ErrNaN is returned by the sorted set operations when a score is, or
+	// would become, NaN, which can't be ordered.
+	ErrNaN = errors.New("cache: score is not a number")
+	// ErrLoadPanicked is returned by GetOrLoad to the callers waiting on a
+	// load function that panicked.
+	ErrLoadPanicked = errors.New("cache: load function panicked")
+)
+
+// A KeyError records the key of the item an operation failed on. Err wraps
+// one of the package's sentinel errors, so callers can test it with
+// errors.Is, e.g. errors.Is(err, ErrNotFound), and retrieve the key with
+// errors.As.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return e.Err.Error() + " (key " + strconv.Quote(e.Key) + ")"
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+func notFoundError(k string) error {
+	return &KeyError{Key: k, Err: ErrNotFound}
+}
+
+func existsError(k string) error {
+	return &KeyError{Key: k, Err: ErrExists}
+}
+
+func typeMismatchError(k, want string) error {
+	return &KeyError{Key: k, Err: fmt.Errorf("%w, expected %s", ErrTypeMismatch, want)}
+}
+
+func overflowError(k string) error {
+	return &KeyError{Key: k, Err: ErrOverflow}
+}
+
+func nanError(k string) error {
+	return &KeyError{Key: k, Err: ErrNaN}
+}
+
+func notOwnerError(k string) error {
+	return &KeyError{Key: k, Err: ErrNotOwner}
+}
+
+func loadPanickedError(k string) error {
+	return &KeyError{Key: k, Err: ErrLoadPanicked}
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestErrNotFound(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("expired", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+
+	for _, k := range []string{"missing", "expired"} {
+		errs := map[string]error{
+			"Replace":        tc.Replace(k, 1, DefaultExpiration),
+			"Increment":      tc.Increment(k, 1),
+			"IncrementFloat": tc.IncrementFloat(k, 1),
+			"Decrement":      tc.Decrement(k, 1),
+			"DecrementFloat": tc.DecrementFloat(k, 1),
+		}
+		_, errs["IncrementChecked"] = tc.IncrementChecked(k, 1)
+		_, errs["IncrementInt8"] = tc.IncrementInt8(k, 1)
+		_, errs["IncrementUint64"] = tc.IncrementUint64(k, 1)
+		_, errs["DecrementFloat32"] = tc.DecrementFloat32(k, 1)
+		_, errs["CompareAndSwap"] = tc.CompareAndSwap(k, 0, 1, DefaultExpiration)
+		for name, err := range errs {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s(%q) returned %v, expected ErrNotFound", name, k, err)
+			}
+			var kerr *KeyError
+			if !errors.As(err, &kerr) || kerr.Key != k {
+				t.Errorf("%s(%q) did not return a KeyError for the key: %v", name, k, err)
+			}
+		}
+	}
+}
+
+func TestErrExists(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("foo", 1, DefaultExpiration)
+	err := tc.Add("foo", 2, DefaultExpiration)
+	if !errors.Is(err, ErrExists) {
+		t.Error("Add returned", err, "expected ErrExists")
+	}
+	var kerr *KeyError
+	if !errors.As(err, &kerr) || kerr.Key != "foo" {
+		t.Error("Add did not return a KeyError for foo:", err)
+	}
+}
+
+func TestErrTypeMismatch(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("string", "foo", DefaultExpiration)
+	tc.Set("int", 1, DefaultExpiration)
+
+	errs := map[string]error{
+		"Increment":      tc.Increment("string", 1),
+		"IncrementFloat": tc.IncrementFloat("int", 1),
+		"Decrement":      tc.Decrement("string", 1),
+		"DecrementFloat": tc.DecrementFloat("int", 1),
+	}
+	_, errs["DecrementChecked"] = tc.DecrementChecked("string", 1)
+	_, errs["IncrementInt8"] = tc.IncrementInt8("int", 1)
+	_, errs["IncrementUintptr"] = tc.IncrementUintptr("int", 1)
+	_, errs["DecrementInt64"] = tc.DecrementInt64("int", 1)
+	_, errs["DecrementFloat64"] = tc.DecrementFloat64("int", 1)
+	_, errs["IncrementInt64OrSet"] = tc.IncrementInt64OrSet("int", 1, 0, DefaultExpiration, false)
+	for name, err := range errs {
+		if !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("%s returned %v, expected ErrTypeMismatch", name, err)
+		}
+		if errors.Is(err, ErrNotFound) {
+			t.Errorf("%s returned %v, which should not be ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestErrOverflow(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("int8", int8(127), DefaultExpiration)
+	_, err := tc.IncrementChecked("int8", 1)
+	if !errors.Is(err, ErrOverflow) {
+		t.Error("IncrementChecked returned", err, "expected ErrOverflow")
+	}
+	var kerr *KeyError
+	if !errors.As(err, &kerr) || kerr.Key != "int8" {
+		t.Error("IncrementChecked did not return a KeyError for int8:", err)
+	}
+}
+
+func TestKeyErrorMessage(t *testing.T) {
+	err := typeMismatchError("foo", "int8")
+	want := `cache: item has the wrong type, expected int8 (key "foo")`
+	if err.Error() != want {
+		t.Errorf("KeyError message is %q, want %q", err.Error(), want)
+	}
+}
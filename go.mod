@@ -1,6 +1,6 @@
 module github.com/ghstahl/go-atomic-cache
 
-go 1.13
+go 1.20
 
 require (
 	go.uber.org/atomic v1.5.0
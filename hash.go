@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Hashes are stored as Hash values; see the comment in set.go. Each field may
+// have its own expiration, after which it is ignored and eventually dropped
+// the next time the hash is modified.
+
+// A Hash is the value stored by HSet: its fields, by name.
+type Hash map[string]HashField
+
+// A HashField is the value of a field of a Hash.
+type HashField struct {
+	Value interface{}
+	// Expiration is the time the field expires, in Unix nanoseconds, or 0
+	// if it doesn't expire on its own.
+	Expiration int64
+}
+
+func (f HashField) expired(now int64) bool {
+	return f.Expiration > 0 && now > f.Expiration
+}
+
+func newHash() interface{} {
+	return Hash{}
+}
+
+// clone returns a copy of the hash without its expired fields.
+func (h Hash) clone(now int64) Hash {
+	nh := make(Hash, len(h)+1)
+	for name, f := range h {
+		if !f.expired(now) {
+			nh[name] = f
+		}
+	}
+	return nh
+}
+
+// Set field to x in the hash stored under k, creating the hash with the
+// default expiration if it doesn't exist or has expired. The field doesn't
+// expire on its own. Returns true if the field is new, or an error wrapping
+// ErrTypeMismatch if k holds something other than a Hash. The hash keeps its
+// expiration.
+func (c *cache) HSet(k, field string, x interface{}) (bool, error) {
+	return c.HSetWithExpiration(k, field, x, NoExpiration)
+}
+
+// Like HSet, but the field expires after d, independently of the hash and its
+// other fields. If d is less than one, the field doesn't expire on its own.
+func (c *cache) HSetWithExpiration(k, field string, x interface{}, d time.Duration) (bool, error) {
+	var created bool
+	err := c.replaceCollection(k, newHash, func(v interface{}) (interface{}, error) {
+		h, ok := v.(Hash)
+		if !ok {
+			return nil, typeMismatchError(k, "Hash")
+		}
+		now := time.Now().UnixNano()
+		nh := h.clone(now)
+		var e int64
+		if d > 0 {
+			e = now + int64(d)
+		}
+		_, exists := nh[field]
+		created = !exists
+		nh[field] = HashField{Value: x, Expiration: e}
+		return nh, nil
+	})
+	return created, err
+}
+
+// Returns the value of field in the hash stored under k, and whether it was
+// found.
+func (c *cache) HGet(k, field string) (interface{}, bool, error) {
+	h, ok := c.getCollection(k, newHash).(Hash)
+	if !ok {
+		return nil, false, typeMismatchError(k, "Hash")
+	}
+	f, found := h[field]
+	if !found || f.expired(time.Now().UnixNano()) {
+		return nil, false, nil
+	}
+	return f.Value, true, nil
+}
+
+// Remove fields from the hash stored under k. Returns the number of unexpired
+// fields that were removed. The hash keeps its expiration, even once empty.
+func (c *cache) HDel(k string, fields ...string) (int, error) {
+	var n int
+	err := c.replaceCollection(k, nil, func(v interface{}) (interface{}, error) {
+		h, ok := v.(Hash)
+		if !ok {
+			return nil, typeMismatchError(k, "Hash")
+		}
+		n = 0
+		nh := h.clone(time.Now().UnixNano())
+		for _, name := range fields {
+			if _, ok := nh[name]; ok {
+				delete(nh, name)
+				n++
+			}
+		}
+		return nh, nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	return n, err
+}
+
+// Returns a copy of the unexpired fields of the hash stored under k. A
+// missing hash is treated as empty.
+func (c *cache) HGetAll(k string) (map[string]interface{}, error) {
+	h, ok := c.getCollection(k, newHash).(Hash)
+	if !ok {
+		return nil, typeMismatchError(k, "Hash")
+	}
+	m := make(map[string]interface{}, len(h))
+	now := time.Now().UnixNano()
+	for name, f := range h {
+		if !f.expired(now) {
+			m[name] = f.Value
+		}
+	}
+	return m, nil
+}
+
+// Increment the int64 value of field in the hash stored under k by n,
+// treating a missing or expired field as 0. The field keeps its expiration.
+// Returns the new value, or an error wrapping ErrTypeMismatch if the field's
+// value isn't an int64, or ErrOverflow, leaving the field unchanged, if the
+// result would not fit in an int64.
+func (c *cache) HIncrBy(k, field string, n int64) (int64, error) {
+	var nv int64
+	err := c.replaceCollection(k, newHash, func(v interface{}) (interface{}, error) {
+		h, ok := v.(Hash)
+		if !ok {
+			return nil, typeMismatchError(k, "Hash")
+		}
+		nh := h.clone(time.Now().UnixNano())
+		f, exists := nh[field]
+		if exists {
+			rv, ok := f.Value.(int64)
+			if !ok {
+				return nil, typeMismatchError(k, "int64 field")
+			}
+			var overflow int
+			nv, overflow = addSigned(rv, n, false, math.MinInt64, math.MaxInt64)
+			if overflow != 0 {
+				return nil, overflowError(k)
+			}
+		} else {
+			nv = n
+		}
+		f.Value = nv
+		nh[field] = f
+		return nh, nil
+	})
+	return nv, err
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHash(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if created, err := tc.HSet("user:1", "name", "Ann"); err != nil || !created {
+		t.Fatal("HSet failed:", created, err)
+	}
+	if created, _ := tc.HSet("user:1", "name", "Anne"); created {
+		t.Error("HSet reported an existing field as new")
+	}
+	tc.HSet("user:1", "email", "anne@example.com")
+	if x, found, _ := tc.HGet("user:1", "name"); !found || x != "Anne" {
+		t.Error("name is not Anne:", x, found)
+	}
+	if _, found, _ := tc.HGet("user:1", "age"); found {
+		t.Error("age was found")
+	}
+	if n, _ := tc.HDel("user:1", "email", "age"); n != 1 {
+		t.Error("HDel removed", n, "fields, expected 1")
+	}
+	m, _ := tc.HGetAll("user:1")
+	if !reflect.DeepEqual(m, map[string]interface{}{"name": "Anne"}) {
+		t.Error("Unexpected fields:", m)
+	}
+
+	if m, err := tc.HGetAll("missing"); err != nil || len(m) != 0 {
+		t.Error("HGetAll on a missing hash returned", m, err)
+	}
+	if n, err := tc.HDel("missing", "a"); err != nil || n != 0 {
+		t.Error("HDel on a missing hash returned", n, err)
+	}
+
+	tc.Set("string", "foo", DefaultExpiration)
+	if _, err := tc.HSet("string", "a", 1); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("HSet on a string returned", err)
+	}
+	if _, _, err := tc.HGet("string", "a"); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("HGet on a string returned", err)
+	}
+}
+
+func TestHashValue(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.HSet("h", "a", 1)
+	x, _ := tc.Get("h")
+	tc.HSet("h", "a", 2)
+	tc.HSet("h", "b", 3)
+	if !reflect.DeepEqual(x, Hash{"a": {Value: 1}}) {
+		t.Error("Hash returned by Get was modified:", x)
+	}
+
+	gob.Register(Hash{})
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(tc.Items()); err != nil {
+		t.Fatal("Couldn't encode the items:", err)
+	}
+	var items map[string]Item
+	if err := gob.NewDecoder(&b).Decode(&items); err != nil {
+		t.Fatal("Couldn't decode the items:", err)
+	}
+	if !reflect.DeepEqual(items["h"].Object, Hash{"a": {Value: 2}, "b": {Value: 3}}) {
+		t.Error("Unexpected decoded hash:", items["h"].Object)
+	}
+}
+
+func TestHashFieldExpiration(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.HSet("flags", "permanent", true)
+	tc.HSetWithExpiration("flags", "beta", true, 20*time.Millisecond)
+	if _, found, _ := tc.HGet("flags", "beta"); !found {
+		t.Error("beta was not found")
+	}
+	<-time.After(30 * time.Millisecond)
+	if _, found, _ := tc.HGet("flags", "beta"); found {
+		t.Error("beta was found after expiring")
+	}
+	m, _ := tc.HGetAll("flags")
+	if len(m) != 1 || m["permanent"] != true {
+		t.Error("Unexpected fields:", m)
+	}
+	if created, _ := tc.HSet("flags", "beta", false); !created {
+		t.Error("HSet did not report an expired field as new")
+	}
+}
+
+func TestHIncrBy(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if n, err := tc.HIncrBy("stats", "views", 5); err != nil || n != 5 {
+		t.Error("HIncrBy on a missing hash returned", n, err)
+	}
+	if n, _ := tc.HIncrBy("stats", "views", -2); n != 3 {
+		t.Error("views is not 3:", n)
+	}
+	tc.HSet("stats", "name", "x")
+	if _, err := tc.HIncrBy("stats", "name", 1); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("HIncrBy on a string field returned", err)
+	}
+	tc.HSet("stats", "max", int64(math.MaxInt64))
+	if _, err := tc.HIncrBy("stats", "max", 1); !errors.Is(err, ErrOverflow) {
+		t.Error("HIncrBy past MaxInt64 returned", err)
+	}
+	if x, _, _ := tc.HGet("stats", "max"); x.(int64) != math.MaxInt64 {
+		t.Error("HIncrBy modified max when overflowing:", x)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.HIncrBy("stats", "hits", 1)
+				tc.HGetAll("stats")
+			}
+		}()
+	}
+	wg.Wait()
+	if x, _, _ := tc.HGet("stats", "hits"); x.(int64) != 800 {
+		t.Error("hits is not 800:", x)
+	}
+}
@@ -0,0 +1,88 @@
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// directives holds the parsed directives of a Cache-Control header, mapping
+// lower-case names to their unquoted arguments ("" if they have none).
+type directives map[string]string
+
+func parseCacheControl(h http.Header) directives {
+	d := directives{}
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, arg := part, ""
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				name, arg = part[:i], strings.Trim(part[i+1:], `"`)
+			}
+			d[strings.ToLower(strings.TrimSpace(name))] = arg
+		}
+	}
+	return d
+}
+
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// seconds returns the value of a delta-seconds directive such as max-age.
+func (d directives) seconds(name string) (time.Duration, bool) {
+	arg, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	if n > int64(maxFreshness/time.Second) {
+		return maxFreshness, true
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// parseVary returns the canonical names of the headers listed in the Vary
+// headers of a response, and whether the response varies on everything
+// ("Vary: *").
+func parseVary(h http.Header) ([]string, bool) {
+	var names []string
+	for _, line := range h.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, true
+			}
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names, false
+}
+
+// etagMatch reports whether an If-None-Match header value matches etag,
+// using the weak comparison that If-None-Match calls for.
+func etagMatch(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
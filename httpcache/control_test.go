@@ -0,0 +1,54 @@
+package httpcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	h := http.Header{"Cache-Control": {`Public, max-age="60"`, "s-maxage=abc, no-store"}}
+	d := parseCacheControl(h)
+	if !d.has("public") || !d.has("no-store") || d.has("private") {
+		t.Error("Unexpected directives:", d)
+	}
+	if s, ok := d.seconds("max-age"); !ok || s != time.Minute {
+		t.Error("Unexpected max-age:", s, ok)
+	}
+	if _, ok := d.seconds("s-maxage"); ok {
+		t.Error("Invalid s-maxage was accepted")
+	}
+	if s, _ := parseCacheControl(http.Header{"Cache-Control": {"max-age=99999999999999"}}).seconds("max-age"); s != maxFreshness {
+		t.Error("Huge max-age was not capped:", s)
+	}
+}
+
+func TestParseVary(t *testing.T) {
+	names, all := parseVary(http.Header{"Vary": {"accept-encoding, Accept-Language", "X-Foo"}})
+	if all || len(names) != 3 || names[0] != "Accept-Encoding" || names[2] != "X-Foo" {
+		t.Error("Unexpected Vary:", names, all)
+	}
+	if _, all := parseVary(http.Header{"Vary": {"Accept, *"}}); !all {
+		t.Error("Vary: * was not detected")
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	cases := []struct {
+		inm, etag string
+		want      bool
+	}{
+		{`"a"`, `"a"`, true},
+		{`W/"a"`, `"a"`, true},
+		{`"a"`, `W/"a"`, true},
+		{`"b", "a"`, `"a"`, true},
+		{`*`, `"a"`, true},
+		{`"b"`, `"a"`, false},
+		{`*`, ``, false},
+	}
+	for _, c := range cases {
+		if got := etagMatch(c.inm, c.etag); got != c.want {
+			t.Errorf("etagMatch(%q, %q) = %v", c.inm, c.etag, got)
+		}
+	}
+}
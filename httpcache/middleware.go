@@ -0,0 +1,242 @@
+// Package httpcache implements net/http middleware that caches responses in a
+// cache.Cache, acting as a shared cache in front of the wrapped handler.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+// maxFreshness caps the freshness lifetime of a response.
+const maxFreshness = 365 * 24 * time.Hour
+
+// errNotShared is returned by a load whose response must not be given to the
+// requests waiting on it.
+var errNotShared = errors.New("httpcache: response can't be shared")
+
+// A Middleware caches the GET and HEAD responses of the handlers it wraps.
+// Responses are keyed by method, host, URL and the request headers named by
+// their Vary header, and are stored in the cache under keys prefixed with
+// "httpcache:".
+//
+// A response is cached for its s-maxage, or else its max-age, or else the
+// default TTL set with SetDefaultTTL (zero unless set, meaning that such
+// responses aren't cached). Responses marked no-store, private or no-cache,
+// partial responses, responses setting cookies, responses with "Vary: *",
+// and responses to requests with an Authorization header that aren't marked
+// public or s-maxage are not cached. Requests marked no-store or no-cache
+// bypass the cache.
+//
+// Concurrent requests for a response that isn't cached wait for a single
+// call to the wrapped handler. Cached responses that have no ETag are given
+// one, and requests whose If-None-Match matches it get a 304 Not Modified.
+type Middleware struct {
+	c          *cache.Cache
+	defaultTTL time.Duration
+}
+
+// Returns a middleware that stores responses in c.
+func New(c *cache.Cache) *Middleware {
+	return &Middleware{c: c}
+}
+
+// Sets how long responses without max-age or s-maxage are cached. It must
+// be called before the middleware starts serving requests.
+func (m *Middleware) SetDefaultTTL(d time.Duration) {
+	m.defaultTTL = d
+}
+
+// Returns next wrapped by the middleware.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.serve(w, r, next)
+	})
+}
+
+// An entry is a cached response. Entries are never modified once stored.
+type entry struct {
+	status int
+	header http.Header
+	body   []byte
+	stored time.Time
+	vary   []string
+}
+
+func (m *Middleware) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		next.ServeHTTP(w, r)
+		return
+	}
+	if cc := parseCacheControl(r.Header); cc.has("no-store") || cc.has("no-cache") {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	base := r.Method + " " + r.Host + r.URL.RequestURI()
+	varyKey := "httpcache:vary:" + base
+	var vary []string
+	if x, found := m.c.Get(varyKey); found {
+		vary = x.([]string)
+	}
+	key := entryKey(base, vary, r.Header)
+
+	var rec *recorder
+	x, err := m.c.GetOrLoad(key, func() (interface{}, time.Duration, error) {
+		rec = newRecorder()
+		// Fetch the full response; conditional requests are answered from
+		// the entry
+		lr := r.Clone(r.Context())
+		lr.Header.Del("If-None-Match")
+		lr.Header.Del("If-Modified-Since")
+		next.ServeHTTP(rec, lr)
+
+		e, ttl, ok := m.newEntry(rec, r)
+		if !ok {
+			return nil, 0, errNotShared
+		}
+		if len(e.vary) > 0 || len(vary) > 0 {
+			m.c.Set(varyKey, e.vary, ttl)
+		}
+		if k := entryKey(base, e.vary, r.Header); k != key {
+			// The response varies on other headers than the request was
+			// keyed by, so it may not suit the waiting requests
+			m.c.Set(k, e, ttl)
+			return e, 0, errNotShared
+		}
+		return e, ttl, nil
+	})
+
+	switch {
+	case rec != nil && x != nil:
+		writeEntry(w, r, x.(*entry), "MISS")
+	case rec != nil:
+		rec.writeTo(w)
+	case err != nil:
+		next.ServeHTTP(w, r)
+	default:
+		writeEntry(w, r, x.(*entry), "HIT")
+	}
+}
+
+// entryKey returns the key of the response to a request, given the headers
+// that responses to it vary on.
+func entryKey(base string, vary []string, h http.Header) string {
+	var b strings.Builder
+	b.WriteString("httpcache:response:")
+	b.WriteString(base)
+	for _, name := range vary {
+		b.WriteString("\x00" + name + ":" + strings.Join(h.Values(name), ","))
+	}
+	return b.String()
+}
+
+// newEntry returns the entry for a recorded response and how long to cache
+// it, or false if the response must not be cached.
+func (m *Middleware) newEntry(rec *recorder, r *http.Request) (*entry, time.Duration, bool) {
+	if rec.status < 200 || rec.status == http.StatusPartialContent || rec.status == http.StatusNotModified {
+		return nil, 0, false
+	}
+	cc := parseCacheControl(rec.header)
+	if cc.has("no-store") || cc.has("private") || cc.has("no-cache") {
+		return nil, 0, false
+	}
+	if rec.header.Get("Set-Cookie") != "" {
+		return nil, 0, false
+	}
+	if r.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") {
+		return nil, 0, false
+	}
+	vary, all := parseVary(rec.header)
+	if all {
+		return nil, 0, false
+	}
+	ttl, ok := cc.seconds("s-maxage")
+	if !ok {
+		ttl, ok = cc.seconds("max-age")
+	}
+	if !ok {
+		ttl = m.defaultTTL
+	}
+	if ttl <= 0 {
+		return nil, 0, false
+	}
+
+	header := rec.header.Clone()
+	body := rec.body.Bytes()
+	if header.Get("ETag") == "" && r.Method == http.MethodGet && rec.status == http.StatusOK {
+		sum := sha256.Sum256(body)
+		header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	}
+	return &entry{
+		status: rec.status,
+		header: header,
+		body:   body,
+		stored: time.Now(),
+		vary:   vary,
+	}, ttl, true
+}
+
+func writeEntry(w http.ResponseWriter, r *http.Request, e *entry, xcache string) {
+	h := w.Header()
+	for k, v := range e.header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set("Age", strconv.FormatInt(int64(time.Since(e.stored)/time.Second), 10))
+	h.Set("X-Cache", xcache)
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && e.status == http.StatusOK && etagMatch(inm, e.header.Get("ETag")) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(e.status)
+	if r.Method != http.MethodHead {
+		w.Write(e.body)
+	}
+}
+
+// A recorder is a ResponseWriter that buffers a response.
+type recorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func newRecorder() *recorder {
+	return &recorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+func (rec *recorder) writeTo(w http.ResponseWriter) {
+	h := w.Header()
+	for k, v := range rec.header {
+		h[k] = v
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
@@ -0,0 +1,212 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+	"go.uber.org/atomic"
+)
+
+// counter is a handler that responds with the number of times it has been
+// called, using the given headers.
+type counter struct {
+	calls  atomic.Int32
+	header http.Header
+}
+
+func (c *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := c.calls.Inc()
+	for k, v := range c.header {
+		w.Header()[k] = v
+	}
+	w.Write([]byte("response " + string(rune('0'+n)) + " " + r.Header.Get("Accept-Encoding")))
+}
+
+func newHandler(header http.Header) (*cache.Cache, *counter, http.Handler) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	h := &counter{header: header}
+	return c, h, New(c).Handler(h)
+}
+
+func get(h http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCachesResponses(t *testing.T) {
+	_, c, h := newHandler(http.Header{"Cache-Control": {"max-age=60"}})
+
+	w := get(h, "/a", nil)
+	if w.Header().Get("X-Cache") != "MISS" || w.Body.String() != "response 1 " {
+		t.Error("Unexpected first response:", w.Header(), w.Body.String())
+	}
+	w = get(h, "/a", nil)
+	if w.Header().Get("X-Cache") != "HIT" || w.Body.String() != "response 1 " {
+		t.Error("Unexpected second response:", w.Header(), w.Body.String())
+	}
+	if w.Header().Get("Age") != "0" {
+		t.Error("Unexpected Age:", w.Header().Get("Age"))
+	}
+	get(h, "/a?x=1", nil)
+	if n := c.calls.Load(); n != 2 {
+		t.Error("Handler was called", n, "times")
+	}
+
+	r := httptest.NewRequest("POST", "/a", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if n := c.calls.Load(); n != 3 {
+		t.Error("POST was served from the cache")
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	for _, cc := range []string{"max-age=60", "max-age=1, s-maxage=60", "public, max-age=60"} {
+		tc, _, h := newHandler(http.Header{"Cache-Control": {cc}})
+		get(h, "/", nil)
+		ttl, found := tc.TTL("httpcache:response:GET example.com/")
+		if !found || ttl <= 59*time.Second || ttl > time.Minute {
+			t.Errorf("%q: unexpected TTL %v", cc, ttl)
+		}
+	}
+}
+
+func TestUncacheable(t *testing.T) {
+	for _, header := range []http.Header{
+		{},
+		{"Cache-Control": {"no-store, max-age=60"}},
+		{"Cache-Control": {"private, max-age=60"}},
+		{"Cache-Control": {"no-cache, max-age=60"}},
+		{"Cache-Control": {"max-age=0"}},
+		{"Cache-Control": {"max-age=60"}, "Vary": {"*"}},
+		{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"a=b"}},
+	} {
+		_, c, h := newHandler(header)
+		get(h, "/", nil)
+		if w := get(h, "/", nil); w.Header().Get("X-Cache") != "" || c.calls.Load() != 2 {
+			t.Errorf("%v: response was cached", header)
+		}
+	}
+
+	// Authenticated requests are only cached if the response allows it
+	_, c, h := newHandler(http.Header{"Cache-Control": {"max-age=60"}})
+	auth := http.Header{"Authorization": {"Bearer x"}}
+	get(h, "/", auth)
+	get(h, "/", auth)
+	if n := c.calls.Load(); n != 2 {
+		t.Error("Response to an authenticated request was cached")
+	}
+	_, c, h = newHandler(http.Header{"Cache-Control": {"public, max-age=60"}})
+	get(h, "/", auth)
+	get(h, "/", auth)
+	if n := c.calls.Load(); n != 1 {
+		t.Error("Public response to an authenticated request wasn't cached")
+	}
+
+	// Requests can bypass the cache
+	_, c, h = newHandler(http.Header{"Cache-Control": {"max-age=60"}})
+	get(h, "/", nil)
+	get(h, "/", http.Header{"Cache-Control": {"no-cache"}})
+	if n := c.calls.Load(); n != 2 {
+		t.Error("Request with no-cache was served from the cache")
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	m := New(c)
+	m.SetDefaultTTL(time.Minute)
+	h := &counter{}
+	hh := m.Handler(h)
+	get(hh, "/", nil)
+	get(hh, "/", nil)
+	if n := h.calls.Load(); n != 1 {
+		t.Error("Handler was called", n, "times")
+	}
+}
+
+func TestVary(t *testing.T) {
+	_, c, h := newHandler(http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Encoding"}})
+	gzip := http.Header{"Accept-Encoding": {"gzip"}}
+	identity := http.Header{"Accept-Encoding": {"identity"}}
+
+	if w := get(h, "/", gzip); w.Body.String() != "response 1 gzip" {
+		t.Error("Unexpected response:", w.Body.String())
+	}
+	if w := get(h, "/", identity); w.Body.String() != "response 2 identity" {
+		t.Error("Response was not varied:", w.Body.String())
+	}
+	if w := get(h, "/", gzip); w.Body.String() != "response 1 gzip" || w.Header().Get("X-Cache") != "HIT" {
+		t.Error("Unexpected response:", w.Body.String())
+	}
+	if w := get(h, "/", identity); w.Body.String() != "response 2 identity" || w.Header().Get("X-Cache") != "HIT" {
+		t.Error("Unexpected response:", w.Body.String())
+	}
+	if n := c.calls.Load(); n != 2 {
+		t.Error("Handler was called", n, "times")
+	}
+}
+
+func TestETag(t *testing.T) {
+	_, _, h := newHandler(http.Header{"Cache-Control": {"max-age=60"}})
+
+	w := get(h, "/", nil)
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Cached response has no ETag")
+	}
+	for _, inm := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w = get(h, "/", http.Header{"If-None-Match": {inm}})
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+			t.Errorf("If-None-Match %q: got %d", inm, w.Code)
+		}
+	}
+	if w := get(h, "/", http.Header{"If-None-Match": {`"other"`}}); w.Code != http.StatusOK {
+		t.Error("Non-matching If-None-Match got", w.Code)
+	}
+
+	// The handler's own ETag is kept, and a first conditional request is
+	// answered from the new entry
+	_, _, h = newHandler(http.Header{"Cache-Control": {"max-age=60"}, "Etag": {`"v1"`}})
+	if w := get(h, "/", http.Header{"If-None-Match": {`"v1"`}}); w.Code != http.StatusNotModified {
+		t.Error("Conditional request on a miss got", w.Code)
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	h := New(c).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Inc()
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("slow"))
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := get(h, "/", nil); !strings.Contains(w.Body.String(), "slow") {
+				t.Error("Unexpected response:", w.Body.String())
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Error("Handler was called", n, "times")
+	}
+}
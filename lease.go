@@ -0,0 +1,109 @@
+package cache
+
+import "time"
+
+// A Lease is the value stored under a key locked with Acquire.
+type Lease struct {
+	Owner string
+}
+
+// Sets an (optional) function that is called with the key and owner of a
+// lease that expired without being released, once the expiry is noticed:
+// either when DeleteExpired removes the lease, or when it is acquired,
+// renewed or released after expiring. Set to nil to disable.
+func (c *cache) OnLeaseExpired(f func(key, owner string)) {
+
+	c.onLeaseExpired = f
+
+}
+
+// Acquire the lease on k for owner, for the duration d (see Set). Succeeds if
+// there is no unexpired item under k, or if owner already holds the lease, in
+// which case its expiration is reset to d. Returns an error wrapping ErrExists
+// otherwise.
+func (c *cache) Acquire(k, owner string, d time.Duration) error {
+	unlock := c.lockKey(k)
+
+	var lapsed *Lease
+	if v, found := c.items.Load(k); found {
+		l, isLease := v.(Item).Object.(Lease)
+		if !v.(Item).Expired() {
+			if !isLease || l.Owner != owner {
+				unlock()
+				return existsError(k)
+			}
+		} else if isLease {
+			lapsed = &l
+		}
+	}
+	c.set(k, Lease{Owner: owner}, d)
+	unlock()
+
+	if lapsed != nil && c.onLeaseExpired != nil {
+		c.onLeaseExpired(k, lapsed.Owner)
+	}
+	return nil
+}
+
+// Reset the expiration of the lease on k to d (see Set). Returns an error
+// wrapping ErrNotFound if there is no unexpired lease on k, ErrNotOwner if it
+// is held by someone else, or ErrTypeMismatch if k holds something other than
+// a lease.
+func (c *cache) Renew(k, owner string, d time.Duration) error {
+	return c.updateLease(k, owner, func(item Item) (interface{}, bool) {
+		item.Expiration = c.expiration(d)
+		c.safeStore(k, item)
+		return nil, false
+	})
+}
+
+// Release the lease on k, deleting it. Returns the same errors as Renew.
+func (c *cache) Release(k, owner string) error {
+	return c.updateLease(k, owner, func(item Item) (interface{}, bool) {
+		return c.delete(k)
+	})
+}
+
+// updateLease checks that owner holds the lease on k and calls fn with it
+// while holding the key's lock. fn returns a value to pass to onEvicted once
+// the lock is released, if its bool is true. An expired lease is deleted.
+func (c *cache) updateLease(k, owner string, fn func(item Item) (interface{}, bool)) error {
+	unlock := c.lockKey(k)
+
+	var (
+		err     error
+		lapsed  *Lease
+		ov      interface{}
+		evicted bool
+	)
+	v, found := c.items.Load(k)
+	switch {
+	case !found:
+		err = notFoundError(k)
+	case v.(Item).Expired():
+		err = notFoundError(k)
+		if l, ok := v.(Item).Object.(Lease); ok {
+			lapsed = &l
+			ov, evicted = c.delete(k)
+		}
+	default:
+		l, ok := v.(Item).Object.(Lease)
+		switch {
+		case !ok:
+			err = typeMismatchError(k, "Lease")
+		case l.Owner != owner:
+			err = notOwnerError(k)
+		default:
+			ov, evicted = fn(v.(Item))
+		}
+	}
+	unlock()
+
+	if evicted {
+		c.onEvicted(k, ov)
+	}
+	if lapsed != nil && c.onLeaseExpired != nil {
+		c.onLeaseExpired(k, lapsed.Owner)
+	}
+	return err
+}
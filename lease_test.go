@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if err := tc.Acquire("job", "a", time.Minute); err != nil {
+		t.Fatal("Couldn't acquire job:", err)
+	}
+	if err := tc.Acquire("job", "b", time.Minute); !errors.Is(err, ErrExists) {
+		t.Error("b acquired job while a holds it:", err)
+	}
+	if err := tc.Acquire("job", "a", time.Minute); err != nil {
+		t.Error("a couldn't re-acquire job:", err)
+	}
+	if err := tc.Renew("job", "b", time.Minute); !errors.Is(err, ErrNotOwner) {
+		t.Error("b renewed job while a holds it:", err)
+	}
+	if err := tc.Renew("job", "a", time.Hour); err != nil {
+		t.Error("a couldn't renew job:", err)
+	}
+	_, expiration, _ := tc.GetWithExpiration("job")
+	if time.Until(expiration) < 59*time.Minute {
+		t.Error("Renew did not extend job:", expiration)
+	}
+	if err := tc.Release("job", "b"); !errors.Is(err, ErrNotOwner) {
+		t.Error("b released job while a holds it:", err)
+	}
+	if err := tc.Release("job", "a"); err != nil {
+		t.Error("a couldn't release job:", err)
+	}
+	if err := tc.Release("job", "a"); !errors.Is(err, ErrNotFound) {
+		t.Error("a released job twice:", err)
+	}
+	if err := tc.Acquire("job", "b", time.Minute); err != nil {
+		t.Error("b couldn't acquire job after it was released:", err)
+	}
+
+	tc.Set("notalease", 1, DefaultExpiration)
+	if err := tc.Acquire("notalease", "a", time.Minute); !errors.Is(err, ErrExists) {
+		t.Error("Acquired a key holding another item:", err)
+	}
+	if err := tc.Renew("notalease", "a", time.Minute); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("Renewed a key holding another item:", err)
+	}
+}
+
+func TestLeaseExpired(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var lapsed []string
+	tc.OnLeaseExpired(func(k, owner string) {
+		lapsed = append(lapsed, k+"/"+owner)
+	})
+
+	tc.Acquire("a", "x", time.Millisecond)
+	tc.Acquire("b", "y", time.Millisecond)
+	tc.Acquire("c", "z", time.Millisecond)
+	tc.Acquire("d", "w", time.Minute)
+	tc.Set("e", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+
+	if err := tc.Acquire("a", "v", time.Minute); err != nil {
+		t.Error("Couldn't acquire an expired lease:", err)
+	}
+	if err := tc.Renew("b", "y", time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Error("Renewed an expired lease:", err)
+	}
+	if len(lapsed) != 2 || lapsed[0] != "a/x" || lapsed[1] != "b/y" {
+		t.Error("Unexpected lapsed leases:", lapsed)
+	}
+
+	tc.DeleteExpired()
+	if len(lapsed) != 3 || lapsed[2] != "c/z" {
+		t.Error("Unexpected lapsed leases after DeleteExpired:", lapsed)
+	}
+}
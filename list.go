@@ -0,0 +1,167 @@
+package cache
+
+// Lists are stored as []interface{} values, so they can also be read with Get
+// and written with Set. The list operations never modify a stored slice in
+// place; they store a new one, so slices returned by Get and LRange stay valid.
+
+// Insert values at the head of the list stored under k, creating it with the
+// default expiration if it doesn't exist or has expired. As in Redis, the
+// values are inserted one after the other, so the last one ends up first.
+// Returns the length of the list, or an error wrapping ErrTypeMismatch if k
+// holds something other than a list. The list keeps its expiration.
+func (c *cache) LPush(k string, values ...interface{}) (int, error) {
+	return c.LPushBounded(k, -1, values...)
+}
+
+// Insert values at the tail of the list stored under k. See LPush.
+func (c *cache) RPush(k string, values ...interface{}) (int, error) {
+	return c.RPushBounded(k, -1, values...)
+}
+
+// Like LPush, but then drop elements from the tail of the list until it is
+// no longer than max. A negative max means no limit.
+func (c *cache) LPushBounded(k string, max int, values ...interface{}) (int, error) {
+	return c.modifyList(k, true, func(l []interface{}) ([]interface{}, error) {
+		nl := make([]interface{}, 0, len(l)+len(values))
+		for i := len(values) - 1; i >= 0; i-- {
+			nl = append(nl, values[i])
+		}
+		nl = append(nl, l...)
+		if max >= 0 && len(nl) > max {
+			nl = nl[:max]
+		}
+		return nl, nil
+	})
+}
+
+// Like RPush, but then drop elements from the head of the list until it is
+// no longer than max. A negative max means no limit.
+func (c *cache) RPushBounded(k string, max int, values ...interface{}) (int, error) {
+	return c.modifyList(k, true, func(l []interface{}) ([]interface{}, error) {
+		// The full slice expression forces append to copy
+		nl := append(l[:len(l):len(l)], values...)
+		if max >= 0 && len(nl) > max {
+			nl = nl[len(nl)-max:]
+		}
+		return nl, nil
+	})
+}
+
+// Remove and return the first element of the list stored under k. Returns an
+// error wrapping ErrNotFound if the list doesn't exist or is empty. Popping
+// the last element leaves an empty list.
+func (c *cache) LPop(k string) (interface{}, error) {
+	return c.pop(k, true)
+}
+
+// Remove and return the last element of the list stored under k. See LPop.
+func (c *cache) RPop(k string) (interface{}, error) {
+	return c.pop(k, false)
+}
+
+func (c *cache) pop(k string, head bool) (interface{}, error) {
+	var x interface{}
+	_, err := c.modifyList(k, false, func(l []interface{}) ([]interface{}, error) {
+		if len(l) == 0 {
+			return nil, notFoundError(k)
+		}
+		if head {
+			x = l[0]
+			return l[1:], nil
+		}
+		x = l[len(l)-1]
+		return l[:len(l)-1], nil
+	})
+	return x, err
+}
+
+// Returns the elements of the list stored under k from start to stop,
+// inclusive. As in Redis, negative indexes count from the end of the list, so
+// LRange(k, 0, -1) returns the whole list, and out of range indexes are
+// clamped. A missing list is treated as empty.
+func (c *cache) LRange(k string, start, stop int) ([]interface{}, error) {
+	l, err := c.getList(k)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := listRange(len(l), start, stop)
+	return l[lo:hi:hi], nil
+}
+
+// Trim the list stored under k to the elements from start to stop, inclusive.
+// See LRange for the meaning of the indexes.
+func (c *cache) LTrim(k string, start, stop int) error {
+	_, err := c.modifyList(k, false, func(l []interface{}) ([]interface{}, error) {
+		lo, hi := listRange(len(l), start, stop)
+		return l[lo:hi:hi], nil
+	})
+	return err
+}
+
+// Returns the length of the list stored under k, or 0 if it doesn't exist.
+func (c *cache) LLen(k string) (int, error) {
+	l, err := c.getList(k)
+	return len(l), err
+}
+
+func (c *cache) getList(k string) ([]interface{}, error) {
+	x, found := c.get(k)
+	if !found {
+		return nil, nil
+	}
+	l, ok := x.([]interface{})
+	if !ok {
+		return nil, typeMismatchError(k, "[]interface{}")
+	}
+	return l, nil
+}
+
+// modifyList atomically replaces the list stored under k with the result of
+// fn, keeping its expiration, and returns the new length. A missing list is
+// created with the default expiration if create is true; otherwise
+// modifyList returns an error wrapping ErrNotFound. Nothing is changed if fn
+// returns an error.
+func (c *cache) modifyList(k string, create bool, fn func(l []interface{}) ([]interface{}, error)) (int, error) {
+	var n int
+	_, _, err := c.modify(k, func(item Item, found bool) (Item, bool, error) {
+		if !found {
+			if !create {
+				return item, false, notFoundError(k)
+			}
+			item.Expiration = c.expiration(DefaultExpiration)
+		}
+		l, ok := item.Object.([]interface{})
+		if found && !ok {
+			return item, false, typeMismatchError(k, "[]interface{}")
+		}
+		nl, err := fn(l)
+		if err != nil {
+			return item, false, err
+		}
+		item.Object = nl
+		n = len(nl)
+		return item, true, nil
+	})
+	return n, err
+}
+
+// listRange converts Redis-style inclusive start and stop indexes into the
+// bounds of a slice expression on a list of length n.
+func listRange(n, start, stop int) (int, int) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop + 1
+}
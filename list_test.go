@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListPushPop(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if n, err := tc.RPush("l", "b", "c"); err != nil || n != 2 {
+		t.Fatal("RPush failed:", n, err)
+	}
+	if n, err := tc.LPush("l", "a", "z"); err != nil || n != 4 {
+		t.Fatal("LPush failed:", n, err)
+	}
+	l, _ := tc.LRange("l", 0, -1)
+	if !reflect.DeepEqual(l, []interface{}{"z", "a", "b", "c"}) {
+		t.Error("Unexpected list:", l)
+	}
+	if x, err := tc.LPop("l"); err != nil || x != "z" {
+		t.Error("LPop did not return z:", x, err)
+	}
+	if x, err := tc.RPop("l"); err != nil || x != "c" {
+		t.Error("RPop did not return c:", x, err)
+	}
+	if n, _ := tc.LLen("l"); n != 2 {
+		t.Error("l does not have length 2:", n)
+	}
+	tc.LPop("l")
+	tc.LPop("l")
+	if _, err := tc.LPop("l"); !errors.Is(err, ErrNotFound) {
+		t.Error("LPop on an empty list returned", err)
+	}
+	if _, err := tc.RPop("missing"); !errors.Is(err, ErrNotFound) {
+		t.Error("RPop on a missing list returned", err)
+	}
+	if n, err := tc.LLen("missing"); err != nil || n != 0 {
+		t.Error("LLen on a missing list returned", n, err)
+	}
+}
+
+func TestListRangeAndTrim(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.RPush("l", 0, 1, 2, 3, 4, 5)
+	tests := []struct {
+		start, stop int
+		want        []interface{}
+	}{
+		{0, 2, []interface{}{0, 1, 2}},
+		{-2, -1, []interface{}{4, 5}},
+		{4, 100, []interface{}{4, 5}},
+		{-100, 0, []interface{}{0}},
+		{3, 1, []interface{}{}},
+	}
+	for _, tt := range tests {
+		l, err := tc.LRange("l", tt.start, tt.stop)
+		if err != nil || !reflect.DeepEqual(l, tt.want) {
+			t.Errorf("LRange(%d, %d) = %v, %v, want %v", tt.start, tt.stop, l, err, tt.want)
+		}
+	}
+
+	before, _ := tc.LRange("l", 0, -1)
+	if err := tc.LTrim("l", 1, -2); err != nil {
+		t.Error("LTrim failed:", err)
+	}
+	l, _ := tc.LRange("l", 0, -1)
+	if !reflect.DeepEqual(l, []interface{}{1, 2, 3, 4}) {
+		t.Error("Unexpected list after LTrim:", l)
+	}
+	tc.RPush("l", 9)
+	if len(before) != 6 || before[5] != 5 {
+		t.Error("RPush modified a previously returned range:", before)
+	}
+}
+
+func TestListBounded(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	for i := 0; i < 10; i++ {
+		tc.LPushBounded("recent", 3, i)
+	}
+	l, _ := tc.LRange("recent", 0, -1)
+	if !reflect.DeepEqual(l, []interface{}{9, 8, 7}) {
+		t.Error("Unexpected bounded list:", l)
+	}
+	for i := 0; i < 10; i++ {
+		tc.RPushBounded("log", 3, i)
+	}
+	l, _ = tc.LRange("log", 0, -1)
+	if !reflect.DeepEqual(l, []interface{}{7, 8, 9}) {
+		t.Error("Unexpected bounded list:", l)
+	}
+}
+
+func TestListExpirationAndType(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("l", []interface{}{"a"}, 50*time.Millisecond)
+	_, e1, _ := tc.GetWithExpiration("l")
+	tc.RPush("l", "b")
+	x, e2, _ := tc.GetWithExpiration("l")
+	if !e1.Equal(e2) {
+		t.Error("RPush changed the expiration of l")
+	}
+	if len(x.([]interface{})) != 2 {
+		t.Error("l is not readable with Get:", x)
+	}
+
+	tc.Set("s", "string", DefaultExpiration)
+	if _, err := tc.RPush("s", "a"); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("RPush on a string returned", err)
+	}
+	if _, err := tc.LRange("s", 0, -1); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("LRange on a string returned", err)
+	}
+}
+
+func TestListConcurrent(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.RPush("l", j)
+				tc.LRange("l", 0, -1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _ := tc.LLen("l"); n != 800 {
+		t.Error("l does not have length 800:", n)
+	}
+}
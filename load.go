@@ -0,0 +1,73 @@
+package cache
+
+import "time"
+
+// loadCall is a GetOrLoad load in progress. x and err are set before done is
+// closed.
+type loadCall struct {
+	done chan struct{}
+	x    interface{}
+	err  error
+}
+
+// testHookLoadWait, if set, is called by GetOrLoad before it waits for a
+// load in progress.
+var testHookLoadWait func(k string)
+
+// Get an item from the cache or, if it doesn't exist or has expired, call load
+// to produce it and store it with the returned expiration duration (see Set).
+// Concurrent calls for a key whose load is in progress wait for it and share
+// its result instead of calling load themselves, so that an expensive value
+// is only computed once when it is missing.
+//
+// If load returns an error nothing is stored, and the error is returned to
+// the caller that ran load and to every caller waiting on it. If load panics,
+// the panic propagates to the caller that ran it, and the waiting callers get
+// an error wrapping ErrLoadPanicked.
+func (c *cache) GetOrLoad(k string, load func() (interface{}, time.Duration, error)) (interface{}, error) {
+	if x, found := c.Get(k); found {
+		return x, nil
+	}
+
+	call := &loadCall{done: make(chan struct{})}
+	if v, loaded := c.loads.LoadOrStore(k, call); loaded {
+		call = v.(*loadCall)
+		if testHookLoadWait != nil {
+			testHookLoadWait(k)
+		}
+		<-call.done
+		return call.x, call.err
+	}
+
+	// The previous load may have finished between the Get and the
+	// LoadOrStore
+	if x, found := c.Get(k); found {
+		call.x = x
+		c.loads.Delete(k)
+		close(call.done)
+		return x, nil
+	}
+
+	c.runLoad(k, call, load)
+	return call.x, call.err
+}
+
+func (c *cache) runLoad(k string, call *loadCall, load func() (interface{}, time.Duration, error)) {
+	panicked := true
+	defer func() {
+		if panicked {
+			call.err = loadPanickedError(k)
+		}
+		// The item has been stored by now, so callers arriving after the
+		// Delete find it with Get
+		c.loads.Delete(k)
+		close(call.done)
+	}()
+
+	x, d, err := load()
+	if err == nil {
+		c.Set(k, x, d)
+	}
+	call.x, call.err = x, err
+	panicked = false
+}
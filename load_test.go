@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	calls := 0
+	load := func() (interface{}, time.Duration, error) {
+		calls++
+		return "value", DefaultExpiration, nil
+	}
+	for i := 0; i < 2; i++ {
+		x, err := tc.GetOrLoad("foo", load)
+		if err != nil || x.(string) != "value" {
+			t.Error("GetOrLoad returned", x, err)
+		}
+	}
+	if calls != 1 {
+		t.Error("load was called", calls, "times")
+	}
+
+	errLoad := errors.New("load failed")
+	_, err := tc.GetOrLoad("bar", func() (interface{}, time.Duration, error) {
+		return nil, 0, errLoad
+	})
+	if err != errLoad {
+		t.Error("GetOrLoad didn't return the load error:", err)
+	}
+	if _, found := tc.Get("bar"); found {
+		t.Error("A failed load stored an item")
+	}
+}
+
+func TestGetOrLoadCoalesces(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	release := make(chan struct{})
+	load := func() (interface{}, time.Duration, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		return 42, DefaultExpiration, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x, err := tc.GetOrLoad("foo", load)
+			if err != nil || x.(int) != 42 {
+				t.Error("GetOrLoad returned", x, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Error("load was called", calls, "times")
+	}
+}
+
+func TestGetOrLoadPanic(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	queued := make(chan struct{})
+	testHookLoadWait = func(k string) { close(queued) }
+	defer func() { testHookLoadWait = nil }()
+
+	started := make(chan struct{})
+	waiter := make(chan error)
+	go func() {
+		<-started
+		_, err := tc.GetOrLoad("foo", func() (interface{}, time.Duration, error) {
+			t.Error("The waiting caller ran its own load")
+			return nil, 0, nil
+		})
+		waiter <- err
+	}()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("The panic didn't propagate")
+			}
+		}()
+		tc.GetOrLoad("foo", func() (interface{}, time.Duration, error) {
+			close(started)
+			<-queued
+			panic("boom")
+		})
+	}()
+	if err := <-waiter; !errors.Is(err, ErrLoadPanicked) {
+		t.Error("Waiting caller got", err)
+	}
+
+	x, err := tc.GetOrLoad("foo", func() (interface{}, time.Duration, error) {
+		return 1, DefaultExpiration, nil
+	})
+	if err != nil || x.(int) != 1 {
+		t.Error("GetOrLoad after a panic returned", x, err)
+	}
+}
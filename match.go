@@ -0,0 +1,107 @@
+package cache
+
+// MatchGlob reports whether s matches the Redis-style glob pattern, as used by
+// DeleteMatching and Scan. The pattern supports '*' (any run of characters),
+// '?' (any single character), '[...]' character classes with ranges and '^'
+// negation, and '\' to escape the following character.
+//
+// Matching takes O(len(pattern)*len(s)) time at worst: a mismatch only
+// backtracks to the most recent '*', since every other element of the
+// pattern matches exactly one character.
+func MatchGlob(pattern, s string) bool {
+	p, i := 0, 0
+	// The position after the most recent star, and the position in s it
+	// currently matches up to
+	star, starI := -1, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				p++
+				star, starI = p, i
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				matched, rest := matchClass(pattern[p+1:], s[i])
+				if matched {
+					p = len(pattern) - len(rest)
+					i++
+					continue
+				}
+			case '\\':
+				q := p
+				if p+1 < len(pattern) {
+					q = p + 1
+				}
+				if pattern[q] == s[i] {
+					p = q + 1
+					i++
+					continue
+				}
+			default:
+				if pattern[p] == s[i] {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+		// Let the most recent star match one more character
+		if star < 0 {
+			return false
+		}
+		starI++
+		p, i = star, starI
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches b against the character class at the start of pattern
+// (just past the opening '['). It returns whether b is in the class and the
+// remainder of the pattern after the closing ']'. An unterminated class runs
+// to the end of the pattern, as in Redis.
+func matchClass(pattern string, b byte) (bool, string) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) >= 2:
+			if pattern[1] == b {
+				matched = true
+			}
+			pattern = pattern[2:]
+		case len(pattern) >= 3 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if b >= lo && b <= hi {
+				matched = true
+			}
+			pattern = pattern[3:]
+		default:
+			if pattern[0] == b {
+				matched = true
+			}
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		// Skip the closing ']'.
+		pattern = pattern[1:]
+	}
+	if negate {
+		matched = !matched
+	}
+	return matched, pattern
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXbY", false},
+		{"*a*b", "aaXbb", true},
+		{"a*", "", false},
+		{"**", "", true},
+		{"[ab", "a", true},
+		{`\`, `\`, true},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestMatchGlobPathological(t *testing.T) {
+	s := strings.Repeat("a", 100)
+	start := time.Now()
+	if MatchGlob("*a*a*a*a*a*a*a*a*a*b", s) {
+		t.Error("pattern should not match")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("match took %v", d)
+	}
+}
@@ -0,0 +1,606 @@
+// Package memcached serves a cache.Cache over the memcached text protocol, so
+// that programs written in other languages can share a Go program's cache.
+//
+// Values stored through the protocol are kept in the cache as []byte, or as
+// a Value when the client sets non-zero flags. Items set by Go code are
+// visible to clients if they are strings, []byte or Values; items of other
+// types are reported as missing.
+package memcached
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+	"go.uber.org/atomic"
+)
+
+const (
+	// maxKeyLength is the longest key the protocol allows.
+	maxKeyLength = 250
+	// maxItemSize is the largest value accepted by the storage commands.
+	maxItemSize = 1 << 20
+	// maxLineLength is the longest command line accepted.
+	maxLineLength = 64 << 10
+	// maxRelativeExptime is the largest exptime interpreted as a number of
+	// seconds from now; larger values are absolute Unix times.
+	maxRelativeExptime = 30 * 24 * 60 * 60
+
+	version = "go-atomic-cache"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after a call to
+// Close.
+var ErrServerClosed = errors.New("memcached: server closed")
+
+var (
+	errNotValue   = errors.New("memcached: item is not a string or []byte")
+	errNonNumeric = errors.New("memcached: item is not a decimal number")
+)
+
+// A Value is an item stored with non-zero flags. Items stored with zero flags
+// are kept as plain []byte.
+type Value struct {
+	Flags uint32
+	Data  []byte
+}
+
+// A Server serves a cache over the memcached text protocol.
+type Server struct {
+	c     *cache.Cache
+	start time.Time
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+
+	currConnections  atomic.Int64
+	totalConnections atomic.Uint64
+	cmdGet           atomic.Uint64
+	cmdSet           atomic.Uint64
+	cmdTouch         atomic.Uint64
+	cmdFlush         atomic.Uint64
+	getHits          atomic.Uint64
+	getMisses        atomic.Uint64
+	deleteHits       atomic.Uint64
+	deleteMisses     atomic.Uint64
+	incrHits         atomic.Uint64
+	incrMisses       atomic.Uint64
+	decrHits         atomic.Uint64
+	decrMisses       atomic.Uint64
+	casHits          atomic.Uint64
+	casMisses        atomic.Uint64
+	casBadval        atomic.Uint64
+	touchHits        atomic.Uint64
+	touchMisses      atomic.Uint64
+}
+
+// Returns a server backed by c.
+func New(c *cache.Cache) *Server {
+	return &Server{
+		c:         c,
+		start:     time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Listens on the given network ("tcp", "tcp4", "tcp6" or "unix") and address,
+// and serves connections until Close is called. See Serve.
+func (s *Server) ListenAndServe(network, address string) error {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Accepts connections on l and serves each of them in its own goroutine.
+// Serve always returns a non-nil error and closes l; after Close it returns
+// ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Closes every listener and connection of the server.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.currConnections.Inc()
+	s.totalConnections.Inc()
+	return true
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.currConnections.Dec()
+		conn.Close()
+	}()
+
+	r := bufio.NewReaderSize(conn, maxLineLength)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			w.WriteString("CLIENT_ERROR line too long\r\n")
+			w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			w.WriteString("ERROR\r\n")
+		} else if !s.dispatch(fields, r, w) {
+			w.Flush()
+			return
+		}
+		// Only flush once the client has no more pipelined commands
+		if r.Buffered() == 0 {
+			if w.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// dispatch runs a single command, and returns false if the connection should
+// be closed.
+func (s *Server) dispatch(fields []string, r *bufio.Reader, w *bufio.Writer) bool {
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case "get", "gets":
+		s.get(args, cmd == "gets", w)
+	case "set", "add", "replace", "append", "prepend", "cas":
+		return s.store(cmd, args, r, w)
+	case "incr", "decr":
+		s.incr(args, cmd == "decr", w)
+	case "delete":
+		s.delete(args, w)
+	case "touch":
+		s.touch(args, w)
+	case "flush_all":
+		s.flushAll(args, w)
+	case "stats":
+		s.stats(args, w)
+	case "version":
+		w.WriteString("VERSION " + version + "\r\n")
+	case "quit":
+		return false
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return true
+}
+
+// noreply strips a trailing "noreply" from args, reporting whether there was
+// one.
+func noreply(args []string) ([]string, bool) {
+	if n := len(args); n > 0 && args[n-1] == "noreply" {
+		return args[:n-1], true
+	}
+	return args, false
+}
+
+func reply(w *bufio.Writer, quiet bool, s string) {
+	if !quiet {
+		w.WriteString(s + "\r\n")
+	}
+}
+
+func validKey(k string) bool {
+	return len(k) > 0 && len(k) <= maxKeyLength
+}
+
+// expiration converts a protocol exptime into a duration for Set. Zero means
+// the item never expires, values up to 30 days are relative to now, and
+// larger values are absolute Unix times. Negative and past times make the
+// item expire immediately.
+func expiration(exptime int64) time.Duration {
+	if exptime == 0 {
+		return cache.NoExpiration
+	}
+	var d time.Duration
+	if exptime > 0 && exptime <= maxRelativeExptime {
+		d = time.Duration(exptime) * time.Second
+	} else if exptime > 0 {
+		d = time.Until(time.Unix(exptime, 0))
+	}
+	if d <= 0 {
+		// The smallest duration that Set doesn't treat specially
+		return time.Nanosecond
+	}
+	return d
+}
+
+// decode returns the protocol view of an item.
+func decode(x interface{}) (Value, bool) {
+	switch x := x.(type) {
+	case []byte:
+		return Value{Data: x}, true
+	case string:
+		return Value{Data: []byte(x)}, true
+	case Value:
+		return x, true
+	}
+	return Value{}, false
+}
+
+// encode returns the item to store for v. If old, the item v replaces, is a
+// string it stays a string as long as v has no flags.
+func encode(old interface{}, v Value) interface{} {
+	if v.Flags != 0 {
+		return v
+	}
+	if _, ok := old.(string); ok {
+		return string(v.Data)
+	}
+	return v.Data
+}
+
+// update applies fn to an existing item, retrying if the item is modified
+// concurrently. The item keeps its expiration. Returns an error wrapping
+// cache.ErrNotFound if the item doesn't exist or has expired, errNotValue if
+// it can't be decoded, or the error returned by fn.
+func (s *Server) update(k string, fn func(v Value) (Value, error)) (Value, error) {
+	for {
+		x, ver, found := s.c.GetWithVersion(k)
+		if !found {
+			return Value{}, cache.ErrNotFound
+		}
+		v, ok := decode(x)
+		if !ok {
+			return Value{}, errNotValue
+		}
+		ttl, found := s.c.TTL(k)
+		if !found {
+			return Value{}, cache.ErrNotFound
+		}
+		if ttl == 0 {
+			ttl = time.Nanosecond
+		}
+		nv, err := fn(v)
+		if err != nil {
+			return Value{}, err
+		}
+		swapped, err := s.c.CompareAndSwap(k, ver, encode(x, nv), ttl)
+		if err != nil {
+			return Value{}, err
+		}
+		if swapped {
+			return nv, nil
+		}
+	}
+}
+
+func (s *Server) get(keys []string, withCAS bool, w *bufio.Writer) {
+	if len(keys) == 0 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	for _, k := range keys {
+		s.cmdGet.Inc()
+		x, ver, found := s.c.GetWithVersion(k)
+		v, ok := decode(x)
+		if !found || !ok {
+			s.getMisses.Inc()
+			continue
+		}
+		s.getHits.Inc()
+		w.WriteString("VALUE " + k + " " + strconv.FormatUint(uint64(v.Flags), 10) + " " + strconv.Itoa(len(v.Data)))
+		if withCAS {
+			w.WriteString(" " + strconv.FormatUint(ver, 10))
+		}
+		w.WriteString("\r\n")
+		w.Write(v.Data)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+// store handles the commands followed by a data block, and returns false if
+// the data block couldn't be read.
+func (s *Server) store(cmd string, args []string, r *bufio.Reader, w *bufio.Writer) bool {
+	args, quiet := noreply(args)
+	want := 4
+	if cmd == "cas" {
+		want = 5
+	}
+	if len(args) != want || !validKey(args[0]) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return true
+	}
+	k := args[0]
+	flags, err1 := strconv.ParseUint(args[1], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+	n, err3 := strconv.Atoi(args[3])
+	var casUnique uint64
+	var err4 error
+	if cmd == "cas" {
+		casUnique, err4 = strconv.ParseUint(args[4], 10, 64)
+	}
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || n < 0 {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return true
+	}
+	if n > maxItemSize {
+		if _, err := io.CopyN(io.Discard, r, int64(n)+2); err != nil {
+			return false
+		}
+		w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return true
+	}
+
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return false
+	}
+	if data[n] != '\r' || data[n+1] != '\n' {
+		// Skip the rest of the oversized block rather than parse it as a
+		// command
+		if data[n+1] != '\n' {
+			if _, err := r.ReadSlice('\n'); err != nil && err != bufio.ErrBufferFull {
+				return false
+			}
+		}
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return true
+	}
+	data = data[:n]
+	s.cmdSet.Inc()
+
+	v := Value{Flags: uint32(flags), Data: data}
+	d := expiration(exptime)
+	switch cmd {
+	case "set":
+		s.c.Set(k, encode(nil, v), d)
+		reply(w, quiet, "STORED")
+	case "add":
+		if s.c.Add(k, encode(nil, v), d) != nil {
+			reply(w, quiet, "NOT_STORED")
+			return true
+		}
+		reply(w, quiet, "STORED")
+	case "replace":
+		if s.c.Replace(k, encode(nil, v), d) != nil {
+			reply(w, quiet, "NOT_STORED")
+			return true
+		}
+		reply(w, quiet, "STORED")
+	case "append", "prepend":
+		// The item keeps its flags and expiration
+		_, err := s.update(k, func(old Value) (Value, error) {
+			b := make([]byte, 0, len(old.Data)+len(data))
+			if cmd == "append" {
+				b = append(append(b, old.Data...), data...)
+			} else {
+				b = append(append(b, data...), old.Data...)
+			}
+			return Value{Flags: old.Flags, Data: b}, nil
+		})
+		if err != nil {
+			reply(w, quiet, "NOT_STORED")
+			return true
+		}
+		reply(w, quiet, "STORED")
+	case "cas":
+		swapped, err := s.c.CompareAndSwap(k, casUnique, encode(nil, v), d)
+		switch {
+		case err != nil:
+			s.casMisses.Inc()
+			reply(w, quiet, "NOT_FOUND")
+		case !swapped:
+			s.casBadval.Inc()
+			reply(w, quiet, "EXISTS")
+		default:
+			s.casHits.Inc()
+			reply(w, quiet, "STORED")
+		}
+	}
+	return true
+}
+
+func (s *Server) incr(args []string, decr bool, w *bufio.Writer) {
+	args, quiet := noreply(args)
+	if len(args) != 2 || !validKey(args[0]) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+		return
+	}
+
+	var n uint64
+	_, err = s.update(args[0], func(v Value) (Value, error) {
+		var err error
+		n, err = strconv.ParseUint(string(v.Data), 10, 64)
+		if err != nil {
+			return v, errNonNumeric
+		}
+		// Increments wrap around at 64 bits; decrements stop at 0
+		if !decr {
+			n += delta
+		} else if delta > n {
+			n = 0
+		} else {
+			n -= delta
+		}
+		return Value{Flags: v.Flags, Data: []byte(strconv.FormatUint(n, 10))}, nil
+	})
+
+	hits, misses := &s.incrHits, &s.incrMisses
+	if decr {
+		hits, misses = &s.decrHits, &s.decrMisses
+	}
+	switch {
+	case errors.Is(err, cache.ErrNotFound):
+		misses.Inc()
+		reply(w, quiet, "NOT_FOUND")
+	case err != nil:
+		w.WriteString("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+	default:
+		hits.Inc()
+		reply(w, quiet, strconv.FormatUint(n, 10))
+	}
+}
+
+func (s *Server) delete(args []string, w *bufio.Writer) {
+	args, quiet := noreply(args)
+	if len(args) != 1 || !validKey(args[0]) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	if _, found := s.c.GetAndDelete(args[0]); !found {
+		s.deleteMisses.Inc()
+		reply(w, quiet, "NOT_FOUND")
+		return
+	}
+	s.deleteHits.Inc()
+	reply(w, quiet, "DELETED")
+}
+
+func (s *Server) touch(args []string, w *bufio.Writer) {
+	args, quiet := noreply(args)
+	if len(args) != 2 || !validKey(args[0]) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+		return
+	}
+	s.cmdTouch.Inc()
+	if s.c.Touch(args[0], expiration(exptime)) != nil {
+		s.touchMisses.Inc()
+		reply(w, quiet, "NOT_FOUND")
+		return
+	}
+	s.touchHits.Inc()
+	reply(w, quiet, "TOUCHED")
+}
+
+func (s *Server) flushAll(args []string, w *bufio.Writer) {
+	args, quiet := noreply(args)
+	var delay int64
+	if len(args) > 1 {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	if len(args) == 1 {
+		var err error
+		delay, err = strconv.ParseInt(args[0], 10, 64)
+		if err != nil || delay < 0 {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return
+		}
+	}
+	s.cmdFlush.Inc()
+	if delay > 0 {
+		time.AfterFunc(time.Duration(delay)*time.Second, s.c.Flush)
+	} else {
+		s.c.Flush()
+	}
+	reply(w, quiet, "OK")
+}
+
+func (s *Server) stats(args []string, w *bufio.Writer) {
+	if len(args) > 0 {
+		// Stat groups such as "stats items" aren't supported
+		w.WriteString("END\r\n")
+		return
+	}
+	now := time.Now()
+	stat := func(name string, v uint64) {
+		w.WriteString("STAT " + name + " " + strconv.FormatUint(v, 10) + "\r\n")
+	}
+	stat("uptime", uint64(now.Sub(s.start)/time.Second))
+	stat("time", uint64(now.Unix()))
+	w.WriteString("STAT version " + version + "\r\n")
+	stat("curr_connections", uint64(s.currConnections.Load()))
+	stat("total_connections", s.totalConnections.Load())
+	stat("curr_items", uint64(s.c.ItemCount()))
+	stat("cmd_get", s.cmdGet.Load())
+	stat("cmd_set", s.cmdSet.Load())
+	stat("cmd_flush", s.cmdFlush.Load())
+	stat("cmd_touch", s.cmdTouch.Load())
+	stat("get_hits", s.getHits.Load())
+	stat("get_misses", s.getMisses.Load())
+	stat("delete_misses", s.deleteMisses.Load())
+	stat("delete_hits", s.deleteHits.Load())
+	stat("incr_misses", s.incrMisses.Load())
+	stat("incr_hits", s.incrHits.Load())
+	stat("decr_misses", s.decrMisses.Load())
+	stat("decr_hits", s.decrHits.Load())
+	stat("cas_misses", s.casMisses.Load())
+	stat("cas_hits", s.casHits.Load())
+	stat("cas_badval", s.casBadval.Load())
+	stat("touch_hits", s.touchHits.Load())
+	stat("touch_misses", s.touchMisses.Load())
+	w.WriteString("END\r\n")
+}
@@ -0,0 +1,297 @@
+package memcached
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// startServer serves a new cache on a local TCP listener, and returns the
+// cache and a client connected to it.
+func startServer(t *testing.T) (*cache.Cache, *client) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serve(t, l)
+}
+
+func serve(t *testing.T, l net.Listener) (*cache.Cache, *client) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	s := New(c)
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return c, &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// do sends a request and returns the first n lines of the response.
+func (c *client) do(req string, n int) []string {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(req)); err != nil {
+		c.t.Fatal(err)
+	}
+	lines := make([]string, n)
+	for i := range lines {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		lines[i] = strings.TrimSuffix(line, "\r\n")
+	}
+	return lines
+}
+
+// expect sends a request and checks its single line response.
+func (c *client) expect(req, want string) {
+	c.t.Helper()
+	if got := c.do(req, 1)[0]; got != want {
+		c.t.Errorf("%q: got %q, expected %q", req, got, want)
+	}
+}
+
+func TestStorageCommands(t *testing.T) {
+	_, c := startServer(t)
+
+	c.expect("get foo\r\n", "END")
+	c.expect("set foo 0 0 3\r\nbar\r\n", "STORED")
+	if got := c.do("get foo\r\n", 3); got[0] != "VALUE foo 0 3" || got[1] != "bar" || got[2] != "END" {
+		t.Error("Unexpected get response:", got)
+	}
+	c.expect("add foo 0 0 3\r\nbaz\r\n", "NOT_STORED")
+	c.expect("add new 5 0 3\r\nbaz\r\n", "STORED")
+	c.expect("replace missing 0 0 1\r\nx\r\n", "NOT_STORED")
+	c.expect("replace foo 0 0 3\r\nqux\r\n", "STORED")
+	c.expect("append foo 0 0 2\r\n!!\r\n", "STORED")
+	c.expect("prepend foo 0 0 2\r\n<<\r\n", "STORED")
+	c.expect("append missing 0 0 1\r\nx\r\n", "NOT_STORED")
+
+	got := c.do("get foo new missing\r\n", 5)
+	want := []string{"VALUE foo 0 7", "<<qux!!", "VALUE new 5 3", "baz", "END"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Line %d of get is %q, expected %q", i, got[i], want[i])
+		}
+	}
+
+	c.expect("append new 0 0 1\r\n?\r\n", "STORED")
+	if got := c.do("get new\r\n", 3); got[0] != "VALUE new 5 4" || got[1] != "baz?" {
+		t.Error("append didn't keep the flags:", got)
+	}
+}
+
+func TestCas(t *testing.T) {
+	_, c := startServer(t)
+
+	c.expect("cas foo 0 0 1 1\r\nx\r\n", "NOT_FOUND")
+	c.expect("set foo 0 0 1\r\na\r\n", "STORED")
+	got := c.do("gets foo\r\n", 3)
+	fields := strings.Fields(got[0])
+	if len(fields) != 5 || fields[0] != "VALUE" {
+		t.Fatal("Unexpected gets response:", got)
+	}
+	unique := fields[4]
+
+	c.expect("set foo 0 0 1\r\nb\r\n", "STORED")
+	c.expect("cas foo 0 0 1 "+unique+"\r\nc\r\n", "EXISTS")
+
+	fields = strings.Fields(c.do("gets foo\r\n", 3)[0])
+	c.expect("cas foo 0 0 1 "+fields[4]+"\r\nd\r\n", "STORED")
+	if got := c.do("get foo\r\n", 3); got[1] != "d" {
+		t.Error("foo is not d:", got)
+	}
+}
+
+func TestIncrDecr(t *testing.T) {
+	_, c := startServer(t)
+
+	c.expect("incr n 1\r\n", "NOT_FOUND")
+	c.expect("set n 0 0 2\r\n10\r\n", "STORED")
+	c.expect("incr n 5\r\n", "15")
+	c.expect("decr n 3\r\n", "12")
+	c.expect("decr n 100\r\n", "0")
+	c.expect("set n 0 0 20\r\n18446744073709551615\r\n", "STORED")
+	c.expect("incr n 2\r\n", "1")
+	c.expect("incr n x\r\n", "CLIENT_ERROR invalid numeric delta argument")
+	c.expect("set s 0 0 3\r\nabc\r\n", "STORED")
+	c.expect("incr s 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+}
+
+func TestDeleteTouchFlush(t *testing.T) {
+	tc, c := startServer(t)
+
+	c.expect("delete foo\r\n", "NOT_FOUND")
+	c.expect("set foo 0 0 1\r\na\r\n", "STORED")
+	c.expect("delete foo\r\n", "DELETED")
+	c.expect("get foo\r\n", "END")
+
+	c.expect("touch foo 10\r\n", "NOT_FOUND")
+	c.expect("set foo 0 0 1\r\na\r\n", "STORED")
+	c.expect("touch foo 10\r\n", "TOUCHED")
+	if ttl, _ := tc.TTL("foo"); ttl <= 9*time.Second || ttl > 10*time.Second {
+		t.Error("Unexpected TTL after touch:", ttl)
+	}
+	c.expect("touch foo -1\r\n", "TOUCHED")
+	c.expect("get foo\r\n", "END")
+
+	c.expect("set a 0 0 1\r\na\r\n", "STORED")
+	c.expect("set b 0 0 1\r\nb\r\n", "STORED")
+	c.expect("flush_all\r\n", "OK")
+	if n := tc.ItemCount(); n != 0 {
+		t.Error("Item count after flush_all is not 0:", n)
+	}
+}
+
+func TestExptime(t *testing.T) {
+	tc, c := startServer(t)
+
+	c.expect("set rel 0 100 1\r\na\r\n", "STORED")
+	if ttl, _ := tc.TTL("rel"); ttl <= 99*time.Second || ttl > 100*time.Second {
+		t.Error("Unexpected TTL for relative exptime:", ttl)
+	}
+	abs := time.Now().Add(time.Hour).Unix()
+	c.expect("set abs 0 "+strconv.FormatInt(abs, 10)+" 1\r\na\r\n", "STORED")
+	if ttl, _ := tc.TTL("abs"); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Error("Unexpected TTL for absolute exptime:", ttl)
+	}
+	c.expect("set never 0 0 1\r\na\r\n", "STORED")
+	if ttl, _ := tc.TTL("never"); ttl != cache.NoExpiration {
+		t.Error("Item with exptime 0 expires:", ttl)
+	}
+	c.expect("set gone 0 -1 1\r\na\r\n", "STORED")
+	c.expect("get gone\r\n", "END")
+}
+
+func TestNoreply(t *testing.T) {
+	_, c := startServer(t)
+
+	// Only the get produces a response
+	got := c.do("set foo 0 0 1 noreply\r\na\r\nappend foo 0 0 1 noreply\r\nb\r\nincr x 1 noreply\r\nget foo\r\n", 3)
+	if got[0] != "VALUE foo 0 2" || got[1] != "ab" || got[2] != "END" {
+		t.Error("Unexpected response:", got)
+	}
+}
+
+func TestSharedWithCache(t *testing.T) {
+	tc, c := startServer(t)
+
+	tc.Set("str", "hello", cache.DefaultExpiration)
+	tc.Set("int", 42, cache.DefaultExpiration)
+	if got := c.do("get str int\r\n", 3); got[0] != "VALUE str 0 5" || got[1] != "hello" || got[2] != "END" {
+		t.Error("Unexpected get response:", got)
+	}
+	c.expect("append str 0 0 1\r\n!\r\n", "STORED")
+	if x, _ := tc.Get("str"); x != "hello!" {
+		t.Error("str is not the string hello!:", x)
+	}
+
+	c.expect("set flagged 7 0 1\r\nx\r\n", "STORED")
+	if x, _ := tc.Get("flagged"); x.(Value).Flags != 7 {
+		t.Error("flagged is not a Value with flags 7:", x)
+	}
+	c.expect("set plain 0 0 1\r\nx\r\n", "STORED")
+	if x, _ := tc.Get("plain"); string(x.([]byte)) != "x" {
+		t.Error("plain is not []byte x:", x)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, c := startServer(t)
+
+	c.expect("bogus\r\n", "ERROR")
+	c.expect("set foo 0 0\r\n", "CLIENT_ERROR bad command line format")
+	c.expect("set "+strings.Repeat("k", maxKeyLength+1)+" 0 0 1\r\n", "CLIENT_ERROR bad command line format")
+	c.expect("set foo 0 0 1\r\nab\r\n", "CLIENT_ERROR bad data chunk")
+	c.expect("version\r\n", "VERSION "+version)
+}
+
+func TestStats(t *testing.T) {
+	_, c := startServer(t)
+
+	c.expect("set foo 0 0 1\r\na\r\n", "STORED")
+	c.do("get foo bar\r\n", 3)
+	if _, err := c.conn.Write([]byte("stats\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	stats := map[string]string{}
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := strings.Fields(line)
+		if fields[0] == "END" {
+			break
+		}
+		stats[fields[1]] = fields[2]
+	}
+	for name, want := range map[string]string{
+		"curr_items":       "1",
+		"cmd_get":          "2",
+		"cmd_set":          "1",
+		"get_hits":         "1",
+		"get_misses":       "1",
+		"curr_connections": "1",
+	} {
+		if stats[name] != want {
+			t.Errorf("%s is %q, expected %q", name, stats[name], want)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "memcached.sock"))
+	if err != nil {
+		t.Skip("Unix sockets are not supported:", err)
+	}
+	_, c := serve(t, l)
+	c.expect("set foo 0 0 1\r\na\r\n", "STORED")
+	if got := c.do("get foo\r\n", 3); got[1] != "a" {
+		t.Error("Unexpected get response:", got)
+	}
+}
+
+func TestClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(cache.New(cache.DefaultExpiration, 0))
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Make sure the connection has been accepted
+	conn.Write([]byte("version\r\n"))
+	bufio.NewReader(conn).ReadString('\n')
+
+	s.Close()
+	if err := <-done; err != ErrServerClosed {
+		t.Error("Serve returned", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("Connection is still open after Close")
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// MemoizeOptions configures a function returned by Memoize.
+type MemoizeOptions[A any] struct {
+	// Key returns the cache key for an argument. Functions memoized in the
+	// same cache must not produce the same keys. If Key is nil, the key is
+	// "memoize:<n>:" followed by the argument formatted with %#v, where n
+	// is unique to each call to Memoize; arguments containing pointers are
+	// therefore keyed by address.
+	Key func(A) string
+	// TTL is the expiration duration of results, as accepted by Set.
+	TTL time.Duration
+	// CacheErrors makes errors returned by the function be cached too, so
+	// that it isn't called again for the argument until ErrorTTL expires.
+	CacheErrors bool
+	// ErrorTTL is the expiration duration of cached errors. If it is zero,
+	// TTL is used.
+	ErrorTTL time.Duration
+}
+
+// memoizedError is stored in place of a result when errors are cached.
+type memoizedError struct {
+	err error
+}
+
+// memoizeCount numbers the calls to Memoize, to give their default keys
+// distinct prefixes.
+var memoizeCount atomic.Uint64
+
+// Memoize returns a function that calls fn only if its result for the
+// argument isn't in c, and otherwise returns the cached result. Results are
+// stored under the keys given by opts.Key, so other code can read or
+// invalidate them. Concurrent calls with the same argument share a single
+// call to fn (see GetOrLoad). Functions of several arguments can be memoized
+// by passing them as a struct.
+func Memoize[A, R any](c *Cache, fn func(A) (R, error), opts MemoizeOptions[A]) func(A) (R, error) {
+	key := opts.Key
+	if key == nil {
+		prefix := "memoize:" + strconv.FormatUint(memoizeCount.Inc(), 10) + ":"
+		key = func(a A) string {
+			return prefix + fmt.Sprintf("%#v", a)
+		}
+	}
+	errorTTL := opts.ErrorTTL
+	if errorTTL == 0 {
+		errorTTL = opts.TTL
+	}
+
+	return func(a A) (R, error) {
+		var zero R
+		x, err := c.GetOrLoad(key(a), func() (interface{}, time.Duration, error) {
+			r, err := fn(a)
+			if err != nil {
+				if opts.CacheErrors {
+					return memoizedError{err}, errorTTL, nil
+				}
+				return nil, 0, err
+			}
+			return r, opts.TTL, nil
+		})
+		if err != nil {
+			return zero, err
+		}
+		if e, ok := x.(memoizedError); ok {
+			return zero, e.err
+		}
+		// A nil interface can't be asserted to R even when R is an
+		// interface type
+		if x == nil {
+			return zero, nil
+		}
+		return x.(R), nil
+	}
+}
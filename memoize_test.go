@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+func TestMemoize(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var calls atomic.Int32
+	square := Memoize(tc, func(n int) (int, error) {
+		calls.Inc()
+		return n * n, nil
+	}, MemoizeOptions[int]{})
+
+	for i := 0; i < 3; i++ {
+		if r, err := square(4); r != 16 || err != nil {
+			t.Error("square(4) returned", r, err)
+		}
+	}
+	if r, _ := square(5); r != 25 {
+		t.Error("square(5) returned", r)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Error("Function was called", n, "times")
+	}
+
+	// Functions sharing the cache don't share results
+	double := Memoize(tc, func(n int) (int, error) {
+		return 2 * n, nil
+	}, MemoizeOptions[int]{})
+	if r, _ := double(4); r != 8 {
+		t.Error("double(4) returned", r)
+	}
+}
+
+func TestMemoizeKeyAndTTL(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var calls atomic.Int32
+	type args struct {
+		a, b int
+	}
+	add := Memoize(tc, func(x args) (string, error) {
+		calls.Inc()
+		return strconv.Itoa(x.a + x.b), nil
+	}, MemoizeOptions[args]{
+		Key: func(x args) string { return "add:" + strconv.Itoa(x.a) + "+" + strconv.Itoa(x.b) },
+		TTL: 5 * time.Millisecond,
+	})
+
+	add(args{1, 2})
+	if x, found := tc.Get("add:1+2"); !found || x.(string) != "3" {
+		t.Error("Result was not stored under the key:", x)
+	}
+	add(args{1, 2})
+	<-time.After(10 * time.Millisecond)
+	add(args{1, 2})
+	if n := calls.Load(); n != 2 {
+		t.Error("Function was called", n, "times")
+	}
+}
+
+func TestMemoizeErrors(t *testing.T) {
+	errFailed := errors.New("failed")
+	for _, cacheErrors := range []bool{false, true} {
+		tc := New(DefaultExpiration, 0)
+		var calls atomic.Int32
+		f := Memoize(tc, func(s string) (string, error) {
+			calls.Inc()
+			return "", errFailed
+		}, MemoizeOptions[string]{CacheErrors: cacheErrors})
+
+		for i := 0; i < 2; i++ {
+			if _, err := f("x"); err != errFailed {
+				t.Error("Error was not returned:", err)
+			}
+		}
+		want := int32(2)
+		if cacheErrors {
+			want = 1
+		}
+		if n := calls.Load(); n != want {
+			t.Errorf("CacheErrors %v: function was called %d times", cacheErrors, n)
+		}
+	}
+}
+
+func TestMemoizeDefaultKey(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	type args struct {
+		name string
+		n    int
+	}
+	var calls atomic.Int32
+	f := Memoize(tc, func(a args) (string, error) {
+		calls.Inc()
+		return strings.Repeat(a.name, a.n), nil
+	}, MemoizeOptions[args]{})
+
+	f(args{"a", 2})
+	f(args{"a", 2})
+	if r, _ := f(args{"a", 3}); r != "aaa" {
+		t.Error("f(a, 3) returned", r)
+	}
+	if r, _ := f(args{"b", 2}); r != "bb" {
+		t.Error("f(b, 2) returned", r)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Error("Function was called", n, "times")
+	}
+
+	keys := tc.Keys()
+	if len(keys) != 3 {
+		t.Fatal("Unexpected keys:", keys)
+	}
+	for _, k := range keys {
+		if !strings.HasPrefix(k, "memoize:") || !strings.Contains(k, `name:"a"`) && !strings.Contains(k, `name:"b"`) {
+			t.Error("Unexpected key:", k)
+		}
+	}
+}
+
+func TestMemoizeErrorTTL(t *testing.T) {
+	errFailed := errors.New("failed")
+	tc := New(DefaultExpiration, 0)
+	var calls atomic.Int32
+	fail := true
+	f := Memoize(tc, func(s string) (string, error) {
+		calls.Inc()
+		if fail {
+			return "", errFailed
+		}
+		return s, nil
+	}, MemoizeOptions[string]{
+		Key:         func(s string) string { return s },
+		TTL:         time.Hour,
+		CacheErrors: true,
+		ErrorTTL:    5 * time.Millisecond,
+	})
+
+	f("x")
+	if _, err := f("x"); err != errFailed {
+		t.Error("Cached error was not returned:", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Error("Function was called", n, "times while the error was cached")
+	}
+	if _, expiration, _ := tc.GetWithExpiration("x"); time.Until(expiration) > time.Second {
+		t.Error("The error was cached with TTL rather than ErrorTTL:", expiration)
+	}
+
+	<-time.After(10 * time.Millisecond)
+	fail = false
+	if r, err := f("x"); r != "x" || err != nil {
+		t.Error("f returned", r, err, "after the error expired")
+	}
+	if _, expiration, _ := tc.GetWithExpiration("x"); time.Until(expiration) < time.Minute {
+		t.Error("The result was not cached with TTL:", expiration)
+	}
+}
+
+func TestMemoizeNilResults(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	stringer := Memoize(tc, func(s string) (fmt.Stringer, error) {
+		return nil, nil
+	}, MemoizeOptions[string]{})
+	pointer := Memoize(tc, func(s string) (*int, error) {
+		return nil, nil
+	}, MemoizeOptions[string]{})
+	slice := Memoize(tc, func(s string) ([]int, error) {
+		return nil, nil
+	}, MemoizeOptions[string]{})
+
+	for i := 0; i < 2; i++ {
+		if r, err := stringer("x"); r != nil || err != nil {
+			t.Error("stringer returned", r, err)
+		}
+		if r, err := pointer("x"); r != nil || err != nil {
+			t.Error("pointer returned", r, err)
+		}
+		if r, err := slice("x"); r != nil || err != nil {
+			t.Error("slice returned", r, err)
+		}
+	}
+}
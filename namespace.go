@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"strconv"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// A Namespace is a view of a Cache whose keys are transparently qualified with
+// the namespace and its current generation, so that they never collide with
+// the keys of the cache or of other namespaces. Namespaces share the cache's
+// storage and janitor, but have their own default expiration and statistics,
+// and can be invalidated as a whole in constant time.
+type Namespace struct {
+	c                 *cache
+	name              string
+	prefix            string
+	defaultExpiration atomic.Int64
+	generation        atomic.Uint64
+	hits              atomic.Uint64
+	misses            atomic.Uint64
+	sets              atomic.Uint64
+	deletes           atomic.Uint64
+}
+
+// NamespaceStats holds the counters of a Namespace since it was created.
+type NamespaceStats struct {
+	Hits    uint64
+	Misses  uint64
+	Sets    uint64
+	Deletes uint64
+}
+
+// Returns the namespace with the given name, creating it if it doesn't exist.
+// A new namespace uses the cache's default expiration until
+// SetDefaultExpiration is called.
+//
+// Items in a namespace are kept apart from the cache's own items: they are
+// not visible through the cache's methods, including Range, Keys, Items and
+// Scan, whatever their keys. They are removed by Flush, and OnEvicted is
+// called for them with keys of the form "<name>:<generation>:<key>".
+func (c *cache) Namespace(name string) *Namespace {
+	if ns, ok := c.namespaces.Load(name); ok {
+		return ns.(*Namespace)
+	}
+	ns, _ := c.namespaces.LoadOrStore(name, &Namespace{
+		c:      c,
+		name:   name,
+		prefix: name + ":",
+	})
+	return ns.(*Namespace)
+}
+
+// A namespaceKey is the key of a namespaced item in the cache's map. Being of
+// another type than the string keys of the cache's own items, it can never
+// collide with them.
+type namespaceKey struct {
+	ns         *Namespace
+	generation uint64
+	key        string
+}
+
+// String returns the key passed to OnEvicted.
+func (k namespaceKey) String() string {
+	return k.ns.prefix + strconv.FormatUint(k.generation, 10) + ":" + k.key
+}
+
+// stale reports whether k belongs to an earlier generation of its namespace
+// and should be reclaimed by the janitor.
+func (k namespaceKey) stale() bool {
+	return k.generation != k.ns.generation.Load()
+}
+
+// lockItem locks the mutex guarding writes to the item stored in the cache's
+// map under key, a string or a namespaceKey.
+func (c *cache) lockItem(key interface{}) func() {
+	if k, ok := key.(namespaceKey); ok {
+		return c.lockKey(k.key)
+	}
+	return c.lockKey(key.(string))
+}
+
+// itemKey returns the key passed to OnEvicted for the item stored in the
+// cache's map under key.
+func itemKey(key interface{}) string {
+	if k, ok := key.(namespaceKey); ok {
+		return k.String()
+	}
+	return key.(string)
+}
+
+func (n *Namespace) key(k string) namespaceKey {
+	return namespaceKey{ns: n, generation: n.generation.Load(), key: k}
+}
+
+// get returns the unexpired item stored under k.
+func (n *Namespace) get(k namespaceKey) (Item, bool) {
+	v, found := n.c.items.Load(k)
+	if !found || v.(Item).Expired() {
+		return Item{}, false
+	}
+	return v.(Item), true
+}
+
+// set stores an item under k; the caller must hold the key's lock.
+func (n *Namespace) set(k namespaceKey, x interface{}, d time.Duration) {
+	n.c.safeStore(k, Item{
+		Object:     x,
+		Expiration: n.c.expiration(n.expiration(d)),
+	})
+	n.sets.Inc()
+}
+
+func (n *Namespace) expiration(d time.Duration) time.Duration {
+	if d == DefaultExpiration {
+		return time.Duration(n.defaultExpiration.Load())
+	}
+	return d
+}
+
+// Returns the name of the namespace.
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// Sets the default expiration used for items in the namespace. Passing
+// DefaultExpiration makes the namespace fall back to the cache's default.
+func (n *Namespace) SetDefaultExpiration(d time.Duration) {
+	n.defaultExpiration.Store(int64(d))
+}
+
+// Add an item to the namespace, replacing any existing item. See Cache.Set.
+func (n *Namespace) Set(k string, x interface{}, d time.Duration) {
+	defer n.c.lockKey(k)()
+	n.set(n.key(k), x, d)
+}
+
+// Add an item to the namespace, replacing any existing item, using the
+// namespace's default expiration.
+func (n *Namespace) SetDefault(k string, x interface{}) {
+	n.Set(k, x, DefaultExpiration)
+}
+
+// Add an item to the namespace only if an item doesn't already exist for the
+// given key, or if the existing item has expired. Returns an error wrapping
+// ErrExists otherwise.
+func (n *Namespace) Add(k string, x interface{}, d time.Duration) error {
+	defer n.c.lockKey(k)()
+	nk := n.key(k)
+	if _, found := n.get(nk); found {
+		return existsError(k)
+	}
+	n.set(nk, x, d)
+	return nil
+}
+
+// Set a new value for the key only if it already exists in the namespace, and
+// the existing item hasn't expired. Returns an error wrapping ErrNotFound
+// otherwise.
+func (n *Namespace) Replace(k string, x interface{}, d time.Duration) error {
+	defer n.c.lockKey(k)()
+	nk := n.key(k)
+	if _, found := n.get(nk); !found {
+		return notFoundError(k)
+	}
+	n.set(nk, x, d)
+	return nil
+}
+
+// Get an item from the namespace. Returns the item or nil, and a bool
+// indicating whether the key was found.
+func (n *Namespace) Get(k string) (interface{}, bool) {
+	item, found := n.get(n.key(k))
+	if !found {
+		n.misses.Inc()
+		return nil, false
+	}
+	n.hits.Inc()
+	return item.Object, true
+}
+
+// GetWithExpiration returns an item and its expiration time from the
+// namespace. See Cache.GetWithExpiration.
+func (n *Namespace) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+	item, found := n.get(n.key(k))
+	if !found {
+		n.misses.Inc()
+		return nil, time.Time{}, false
+	}
+	n.hits.Inc()
+	if item.Expiration > 0 {
+		return item.Object, time.Unix(0, item.Expiration), true
+	}
+	return item.Object, time.Time{}, true
+}
+
+// Delete an item from the namespace. Does nothing if the key is not in the
+// namespace.
+func (n *Namespace) Delete(k string) {
+	nk := n.key(k)
+	unlock := n.c.lockKey(k)
+	v, found := n.c.safeDelete(nk)
+	unlock()
+
+	n.deletes.Inc()
+	if found && n.c.onEvicted != nil {
+		n.c.onEvicted(nk.String(), v.Object)
+	}
+}
+
+// Makes every item currently in the namespace invisible by moving the
+// namespace to a new generation. The old items are removed by the next
+// DeleteExpired, which the janitor runs periodically.
+func (n *Namespace) InvalidateAll() {
+	n.generation.Inc()
+}
+
+// Returns a snapshot of the namespace's counters.
+func (n *Namespace) Stats() NamespaceStats {
+	return NamespaceStats{
+		Hits:    n.hits.Load(),
+		Misses:  n.misses.Load(),
+		Sets:    n.sets.Load(),
+		Deletes: n.deletes.Load(),
+	}
+}
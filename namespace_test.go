@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	billing := tc.Namespace("billing")
+	users := tc.Namespace("users")
+	if tc.Namespace("billing") != billing {
+		t.Error("Namespace did not return the existing namespace")
+	}
+
+	billing.Set("a", 1, DefaultExpiration)
+	users.Set("a", 2, DefaultExpiration)
+	tc.Set("a", 3, DefaultExpiration)
+
+	if x, found := billing.Get("a"); !found || x.(int) != 1 {
+		t.Error("billing a is not 1:", x)
+	}
+	if x, found := users.Get("a"); !found || x.(int) != 2 {
+		t.Error("users a is not 2:", x)
+	}
+	if x, found := tc.Get("a"); !found || x.(int) != 3 {
+		t.Error("a is not 3:", x)
+	}
+	if err := billing.Add("a", 4, DefaultExpiration); err == nil {
+		t.Error("Successfully added a to billing when it already exists")
+	}
+	billing.Delete("a")
+	if _, found := billing.Get("a"); found {
+		t.Error("billing a was found, but it should have been deleted")
+	}
+
+	stats := billing.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Sets != 1 || stats.Deletes != 1 {
+		t.Errorf("Unexpected billing stats: %+v", stats)
+	}
+}
+
+func TestNamespaceDefaultExpiration(t *testing.T) {
+	tc := New(NoExpiration, 0)
+	ns := tc.Namespace("short")
+	ns.SetDefaultExpiration(50 * time.Millisecond)
+	ns.SetDefault("a", 1)
+	_, expiration, found := ns.GetWithExpiration("a")
+	if !found {
+		t.Fatal("a was not found")
+	}
+	if expiration.IsZero() {
+		t.Error("a did not get the namespace's default expiration")
+	}
+
+	tc.Namespace("other").SetDefault("a", 1)
+	_, expiration, _ = tc.Namespace("other").GetWithExpiration("a")
+	if !expiration.IsZero() {
+		t.Error("other a did not get the cache's default expiration")
+	}
+}
+
+func TestNamespaceInvalidateAll(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	ns := tc.Namespace("billing")
+	ns.Set("a", 1, DefaultExpiration)
+	ns.Set("b", 2, DefaultExpiration)
+	tc.Set("billing", 3, DefaultExpiration)
+	tc.Set("billing:x", 4, DefaultExpiration)
+
+	ns.InvalidateAll()
+	if _, found := ns.Get("a"); found {
+		t.Error("a was found after InvalidateAll")
+	}
+	ns.Set("a", 5, DefaultExpiration)
+	if x, found := ns.Get("a"); !found || x.(int) != 5 {
+		t.Error("a is not 5 after being set in the new generation:", x)
+	}
+
+	evicted := 0
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted++
+	})
+	tc.DeleteExpired()
+	if evicted != 2 {
+		t.Errorf("DeleteExpired reclaimed %d items, expected 2", evicted)
+	}
+	if x, found := ns.Get("a"); !found || x.(int) != 5 {
+		t.Error("a from the current generation was reclaimed:", x)
+	}
+	if _, found := tc.Get("billing"); !found {
+		t.Error("billing was reclaimed")
+	}
+	if _, found := tc.Get("billing:x"); !found {
+		t.Error("billing:x was reclaimed")
+	}
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("user:123:profile", 1, DefaultExpiration)
+	tc.Set("billing:0:a", 2, DefaultExpiration)
+	users := tc.Namespace("user")
+	billing := tc.Namespace("billing")
+
+	if _, found := billing.Get("a"); found {
+		t.Error("billing a was found, but only the cache's billing:0:a was set")
+	}
+	billing.Set("a", 3, DefaultExpiration)
+	if x, found := tc.Get("billing:0:a"); !found || x.(int) != 2 {
+		t.Error("billing:0:a was overwritten by billing a:", x)
+	}
+
+	users.InvalidateAll()
+	tc.DeleteExpired()
+	if _, found := tc.Get("user:123:profile"); !found {
+		t.Error("user:123:profile was reclaimed as a stale namespace item")
+	}
+
+	billing.Set("b", 4, DefaultExpiration)
+	billing.InvalidateAll()
+	keys := tc.Keys()
+	if len(keys) != 2 {
+		t.Error("Keys returned namespaced items:", keys)
+	}
+	if n := len(tc.Items()); n != 2 {
+		t.Error("Items returned", n, "items")
+	}
+	if keys, _ := tc.Scan(0, 10, ""); len(keys) != 2 {
+		t.Error("Scan returned namespaced items:", keys)
+	}
+
+	tc.Flush()
+	if tc.ItemCount() != 0 {
+		t.Error("Flush left", tc.ItemCount(), "items")
+	}
+}
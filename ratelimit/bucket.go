@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+// ErrExceedsBurst is returned by TokenBucket.Wait when more tokens are
+// requested than the bucket can ever hold.
+var ErrExceedsBurst = errors.New("ratelimit: requested tokens exceed burst")
+
+// A TokenBucket is a token bucket limiter whose state is stored in the cache
+// under "ratelimit:bucket:<key>". A bucket holds up to burst tokens and is
+// refilled at rate tokens per second; a bucket that hasn't been used yet is
+// full.
+//
+// The state is stored with the cache's default expiration, so the janitor
+// removes buckets that stay idle for longer than that. A removed bucket is
+// recreated full, so the default expiration should be at least as long as a
+// bucket takes to refill (burst/rate seconds).
+type TokenBucket struct {
+	c     *cache.Cache
+	key   string
+	rate  float64
+	burst int
+	now   func() time.Time
+}
+
+type bucketState struct {
+	tokens float64
+	last   int64
+}
+
+// Returns the token bucket for key, keeping its state in c, refilled at rate
+// tokens per second and holding up to burst tokens. Buckets for the same key
+// share their state, so they should always be used with the same rate and
+// burst.
+func NewTokenBucket(c *cache.Cache, key string, rate float64, burst int) *TokenBucket {
+	return NewTokenBucketWithClock(c, key, rate, burst, time.Now)
+}
+
+// Like NewTokenBucket, but the bucket reads the current time from now instead
+// of time.Now. This is mostly useful in tests.
+func NewTokenBucketWithClock(c *cache.Cache, key string, rate float64, burst int, now func() time.Time) *TokenBucket {
+	return &TokenBucket{
+		c:     c,
+		key:   "ratelimit:bucket:" + key,
+		rate:  rate,
+		burst: burst,
+		now:   now,
+	}
+}
+
+// Takes n tokens from the bucket if it holds at least n, and reports whether
+// it did.
+func (b *TokenBucket) Take(n int) bool {
+	ok, _ := b.take(n)
+	return ok
+}
+
+// Waits until n tokens can be taken from the bucket and takes them, or until
+// ctx is done, in which case ctx.Err() is returned. Returns ErrExceedsBurst
+// if n is larger than the bucket's burst.
+func (b *TokenBucket) Wait(ctx context.Context, n int) error {
+	if n > b.burst {
+		return ErrExceedsBurst
+	}
+	for {
+		ok, wait := b.take(n)
+		if ok {
+			return nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// take atomically refills the bucket and takes n tokens if possible. If not,
+// it returns how long it will take until there are enough tokens.
+func (b *TokenBucket) take(n int) (bool, time.Duration) {
+	now := b.now().UnixNano()
+	var (
+		ok   bool
+		wait time.Duration
+	)
+	b.c.Update(b.key, func(old interface{}, exists bool) (interface{}, time.Duration, bool) {
+		s, found := old.(bucketState)
+		if !found {
+			s = bucketState{tokens: float64(b.burst), last: now}
+		}
+		if now > s.last {
+			s.tokens = math.Min(float64(b.burst), s.tokens+b.rate*float64(now-s.last)/float64(time.Second))
+			s.last = now
+		}
+		if s.tokens >= float64(n) {
+			s.tokens -= float64(n)
+			ok = true
+		} else {
+			// Converting a float64 beyond the range of time.Duration is
+			// undefined, so the wait of very low rates must be capped
+			w := math.Ceil((float64(n) - s.tokens) / b.rate * float64(time.Second))
+			if b.rate > 0 && w < math.MaxInt64 {
+				wait = time.Duration(w)
+			} else {
+				wait = time.Duration(math.MaxInt64)
+			}
+		}
+		// Store the refilled bucket even if no tokens were taken
+		return s, cache.DefaultExpiration, true
+	})
+	return ok, wait
+}
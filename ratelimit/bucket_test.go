@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+func TestTokenBucketTake(t *testing.T) {
+	clock := newFakeClock()
+	tc := cache.New(cache.DefaultExpiration, 0)
+	b := NewTokenBucketWithClock(tc, "a", 2, 5, clock.Now)
+
+	if !b.Take(5) {
+		t.Fatal("Couldn't take the full burst from a new bucket")
+	}
+	if b.Take(1) {
+		t.Error("Took a token from an empty bucket")
+	}
+	clock.Advance(time.Second)
+	if !b.Take(2) {
+		t.Error("Couldn't take the 2 tokens refilled in a second")
+	}
+	if b.Take(1) {
+		t.Error("Took more tokens than were refilled")
+	}
+	clock.Advance(time.Hour)
+	if !b.Take(5) || b.Take(1) {
+		t.Error("Bucket did not refill up to its burst")
+	}
+
+	if !NewTokenBucketWithClock(tc, "b", 2, 5, clock.Now).Take(5) {
+		t.Error("Buckets for different keys share their state")
+	}
+}
+
+func TestTokenBucketIdleExpiry(t *testing.T) {
+	tc := cache.New(10*time.Millisecond, 0)
+	b := NewTokenBucket(tc, "a", 0, 1)
+	if !b.Take(1) {
+		t.Fatal("Couldn't take a token from a new bucket")
+	}
+	if _, found := tc.Get("ratelimit:bucket:a"); !found {
+		t.Fatal("Bucket state was not stored in the cache")
+	}
+	<-time.After(20 * time.Millisecond)
+	tc.DeleteExpired()
+	if _, found := tc.Get("ratelimit:bucket:a"); found {
+		t.Error("Idle bucket did not expire")
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	tc := cache.New(cache.DefaultExpiration, 0)
+	b := NewTokenBucket(tc, "a", 100, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.Wait(context.Background(), 1); err != nil {
+			t.Fatal("Wait failed:", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Error("Wait returned before the tokens were refilled:", elapsed)
+	}
+
+	if err := b.Wait(context.Background(), 2); err != ErrExceedsBurst {
+		t.Error("Wait for more than the burst returned", err)
+	}
+
+	for _, rate := range []float64{0.001, 1e-300} {
+		slow := NewTokenBucket(tc, "slow", rate, 1)
+		tc.Delete("ratelimit:bucket:slow")
+		slow.Take(1)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if err := slow.Wait(ctx, 1); err != context.DeadlineExceeded {
+			t.Errorf("Wait at rate %g did not return the context's error: %v", rate, err)
+		}
+		cancel()
+		if ok, wait := slow.take(1); ok || wait <= 0 {
+			t.Errorf("Wait at rate %g is %v", rate, wait)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Package ratelimit implements rate limiters whose state is kept in a
+// cache.Cache, so that the state of idle clients expires along with the rest
+// of the cache's items.
+package ratelimit
+
+import (
+	"math"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+// Algorithm selects how a Limiter counts requests.
+type Algorithm int
+
+const (
+	// FixedWindow counts requests in consecutive windows aligned to
+	// multiples of the window duration. It is the cheapest algorithm, but
+	// allows up to twice the limit across a window boundary.
+	FixedWindow Algorithm = iota
+	// SlidingLog records the time of every allowed request and counts
+	// those within the last window. It is exact, but stores up to limit
+	// timestamps per key.
+	SlidingLog
+	// SlidingWindowCounter approximates a sliding window by weighting the
+	// previous fixed window's count by how much of it still overlaps the
+	// sliding window.
+	SlidingWindowCounter
+)
+
+func (a Algorithm) prefix() string {
+	switch a {
+	case FixedWindow:
+		return "ratelimit:fixed:"
+	case SlidingLog:
+		return "ratelimit:log:"
+	default:
+		return "ratelimit:counter:"
+	}
+}
+
+// Result describes the outcome of a call to Allow.
+type Result struct {
+	// Allowed reports whether the request is within the limit.
+	Allowed bool
+	// Remaining is the number of further requests that would currently be
+	// allowed.
+	Remaining int
+	// Reset is when the quota is next replenished.
+	Reset time.Time
+}
+
+// A Limiter limits the rate of requests per key. Its state is stored in the
+// cache under keys prefixed with "ratelimit:".
+type Limiter struct {
+	c         *cache.Cache
+	algorithm Algorithm
+	now       func() time.Time
+}
+
+// Returns a limiter using the given algorithm that keeps its state in c.
+func New(c *cache.Cache, algorithm Algorithm) *Limiter {
+	return NewWithClock(c, algorithm, time.Now)
+}
+
+// Like New, but the limiter reads the current time from now instead of
+// time.Now. This is mostly useful in tests.
+func NewWithClock(c *cache.Cache, algorithm Algorithm, now func() time.Time) *Limiter {
+	return &Limiter{
+		c:         c,
+		algorithm: algorithm,
+		now:       now,
+	}
+}
+
+type fixedWindow struct {
+	window int64
+	count  int
+}
+
+type slidingLog struct {
+	times []int64
+}
+
+type windowCounter struct {
+	window   int64
+	count    int
+	previous int
+}
+
+// Reports whether a request for key is allowed under a limit of limit
+// requests per window, counting it if it is. Allow panics if window is not
+// positive or limit is negative.
+func (l *Limiter) Allow(key string, limit int, window time.Duration) Result {
+	if window <= 0 {
+		panic("ratelimit: non-positive window for Allow")
+	}
+	if limit < 0 {
+		panic("ratelimit: negative limit for Allow")
+	}
+	now := l.now().UnixNano()
+	var r Result
+
+	l.c.Update(l.algorithm.prefix()+key, func(old interface{}, exists bool) (interface{}, time.Duration, bool) {
+		switch l.algorithm {
+		case FixedWindow:
+			s, _ := old.(fixedWindow)
+			w := now / int64(window)
+			if s.window != w {
+				s = fixedWindow{window: w}
+			}
+			if s.count < limit {
+				s.count++
+				r.Allowed = true
+			}
+			r.Remaining = limit - s.count
+			r.Reset = time.Unix(0, (w+1)*int64(window))
+			return s, window, true
+
+		case SlidingLog:
+			s, _ := old.(slidingLog)
+			// Copy the live timestamps, since old may still be read
+			times := make([]int64, 0, len(s.times)+1)
+			for _, t := range s.times {
+				if t > now-int64(window) {
+					times = append(times, t)
+				}
+			}
+			if len(times) < limit {
+				times = append(times, now)
+				r.Allowed = true
+			}
+			r.Remaining = limit - len(times)
+			r.Reset = time.Unix(0, now)
+			if len(times) > 0 {
+				r.Reset = time.Unix(0, times[0]+int64(window))
+			}
+			return slidingLog{times: times}, window, true
+
+		default:
+			s, _ := old.(windowCounter)
+			w := now / int64(window)
+			switch s.window {
+			case w:
+			case w - 1:
+				s = windowCounter{window: w, previous: s.count}
+			default:
+				s = windowCounter{window: w}
+			}
+			elapsed := float64(now-w*int64(window)) / float64(window)
+			estimate := func() float64 {
+				return float64(s.previous)*(1-elapsed) + float64(s.count)
+			}
+			if estimate()+1 <= float64(limit) {
+				s.count++
+				r.Allowed = true
+			}
+			r.Remaining = int(math.Floor(float64(limit) - estimate()))
+			if r.Remaining < 0 {
+				r.Remaining = 0
+			}
+			r.Reset = time.Unix(0, (w+1)*int64(window))
+			// The count is needed for one more window as the previous one
+			return s, 2 * window, true
+		}
+	})
+	return r
+}
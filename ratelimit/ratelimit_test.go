@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Unix(1000000, 0)}
+}
+
+func TestFixedWindow(t *testing.T) {
+	clock := newFakeClock()
+	l := NewWithClock(cache.New(cache.DefaultExpiration, 0), FixedWindow, clock.Now)
+
+	for i := 0; i < 3; i++ {
+		r := l.Allow("a", 3, time.Minute)
+		if !r.Allowed {
+			t.Fatalf("Request %d was not allowed", i)
+		}
+		if r.Remaining != 2-i {
+			t.Errorf("Request %d has %d remaining, expected %d", i, r.Remaining, 2-i)
+		}
+		if !r.Reset.Equal(time.Unix(1000020, 0)) {
+			t.Error("Unexpected reset time:", r.Reset)
+		}
+	}
+	if r := l.Allow("a", 3, time.Minute); r.Allowed || r.Remaining != 0 {
+		t.Error("Request over the limit was allowed:", r)
+	}
+	if r := l.Allow("b", 3, time.Minute); !r.Allowed {
+		t.Error("Request for another key was not allowed")
+	}
+
+	clock.Advance(20 * time.Second)
+	if r := l.Allow("a", 3, time.Minute); !r.Allowed || r.Remaining != 2 {
+		t.Error("Request in a new window was not allowed:", r)
+	}
+}
+
+func TestSlidingLog(t *testing.T) {
+	clock := newFakeClock()
+	l := NewWithClock(cache.New(cache.DefaultExpiration, 0), SlidingLog, clock.Now)
+
+	l.Allow("a", 2, time.Minute)
+	clock.Advance(30 * time.Second)
+	r := l.Allow("a", 2, time.Minute)
+	if !r.Allowed || r.Remaining != 0 {
+		t.Fatal("Second request was not allowed:", r)
+	}
+	if !r.Reset.Equal(time.Unix(1000060, 0)) {
+		t.Error("Unexpected reset time:", r.Reset)
+	}
+	if r := l.Allow("a", 2, time.Minute); r.Allowed {
+		t.Error("Request over the limit was allowed")
+	}
+
+	clock.Advance(30*time.Second - time.Nanosecond)
+	if r := l.Allow("a", 2, time.Minute); r.Allowed {
+		t.Error("Request was allowed when the first one was still in the window")
+	}
+	clock.Advance(time.Nanosecond)
+	if r := l.Allow("a", 2, time.Minute); !r.Allowed || r.Remaining != 0 {
+		t.Error("Request was not allowed after the first one left the window:", r)
+	}
+}
+
+func TestSlidingWindowCounter(t *testing.T) {
+	clock := newFakeClock()
+	// Align the clock to the start of a window
+	clock.t = time.Unix(0, 0).Add(time.Duration(clock.t.UnixNano()/int64(time.Minute)) * time.Minute)
+	l := NewWithClock(cache.New(cache.DefaultExpiration, 0), SlidingWindowCounter, clock.Now)
+
+	for i := 0; i < 10; i++ {
+		if r := l.Allow("a", 10, time.Minute); !r.Allowed {
+			t.Fatalf("Request %d was not allowed", i)
+		}
+	}
+	if r := l.Allow("a", 10, time.Minute); r.Allowed {
+		t.Error("Request over the limit was allowed")
+	}
+
+	// A quarter into the next window, 75% of the previous window's 10
+	// requests still count, leaving room for 2.
+	clock.Advance(time.Minute + 15*time.Second)
+	for i := 0; i < 2; i++ {
+		if r := l.Allow("a", 10, time.Minute); !r.Allowed {
+			t.Fatalf("Request %d in the next window was not allowed", i)
+		}
+	}
+	r := l.Allow("a", 10, time.Minute)
+	if r.Allowed {
+		t.Error("Request over the weighted limit was allowed")
+	}
+	if r.Remaining != 0 {
+		t.Error("Unexpected remaining quota:", r.Remaining)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if r := l.Allow("a", 10, time.Minute); !r.Allowed || r.Remaining != 9 {
+		t.Error("Request after two idle windows was not allowed:", r)
+	}
+}
+
+func TestAllowLimits(t *testing.T) {
+	l := New(cache.New(cache.DefaultExpiration, 0), SlidingLog)
+	if r := l.Allow("a", 1e9, time.Minute); !r.Allowed || r.Remaining != 1e9-1 {
+		t.Error("Request under a large limit was not allowed:", r)
+	}
+	if r := l.Allow("b", 0, time.Minute); r.Allowed {
+		t.Error("Request under a limit of 0 was allowed")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Allow did not panic with a negative limit")
+		}
+	}()
+	l.Allow("c", -1, time.Minute)
+}
@@ -0,0 +1,150 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxBulkLength is the longest bulk string accepted in a request, the
+	// same as the memcached server's largest item.
+	maxBulkLength = 1 << 20
+	// maxArrayLength is the largest number of arguments accepted in a
+	// request.
+	maxArrayLength = 1 << 20
+	// maxInlineLength is the longest inline command accepted.
+	maxInlineLength = 64 << 10
+	// maxPrealloc caps the arguments allocated up front from a request
+	// header; a client has to actually send any more than that.
+	maxPrealloc = 1024
+)
+
+// A protocolError is a malformed request, after which the connection is
+// closed.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "Protocol error: " + string(e)
+}
+
+// readCommand reads a request, either an array of bulk strings as sent by
+// client libraries, or an inline command as typed into telnet. It returns nil
+// arguments for an empty inline command.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxArrayLength {
+		return nil, protocolError("invalid multibulk length")
+	}
+	prealloc := n
+	if prealloc > maxPrealloc {
+		prealloc = maxPrealloc
+	}
+	args := make([]string, 0, prealloc)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError("expected '$', got '" + firstByte(line) + "'")
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLength {
+			return nil, protocolError("invalid bulk length")
+		}
+		// Read the string as it arrives rather than allocating the size
+		// claimed by the header up front
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, int64(size)+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		b := buf.Bytes()
+		if b[size] != '\r' || b[size+1] != '\n' {
+			return nil, protocolError("invalid bulk terminator")
+		}
+		args = append(args, string(b[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", protocolError("too big inline request")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func firstByte(s string) string {
+	if s == "" {
+		return ""
+	}
+	return s[:1]
+}
+
+// A writer encodes replies for a connection's protocol version, 2 or 3.
+type writer struct {
+	*bufio.Writer
+	proto int
+}
+
+func (w *writer) simple(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func (w *writer) error(s string) {
+	w.WriteString("-" + s + "\r\n")
+}
+
+func (w *writer) int(n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *writer) bulk(s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (w *writer) null() {
+	if w.proto >= 3 {
+		w.WriteString("_\r\n")
+	} else {
+		w.WriteString("$-1\r\n")
+	}
+}
+
+func (w *writer) array(n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// mapHeader starts a map of n pairs, which RESP2 sends as a flat array.
+func (w *writer) mapHeader(n int) {
+	if w.proto >= 3 {
+		w.WriteString("%" + strconv.Itoa(n) + "\r\n")
+	} else {
+		w.array(2 * n)
+	}
+}
+
+func (w *writer) bulks(ss []string) {
+	w.array(len(ss))
+	for _, s := range ss {
+		w.bulk(s)
+	}
+}
@@ -0,0 +1,92 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n", []string{"GET", "foo"}},
+		{"*1\r\n$0\r\n\r\n", []string{""}},
+		{"*2\r\n$3\r\nSET\r\n$4\r\na\r\nb\r\n", []string{"SET", "a\r\nb"}},
+		{"SET  foo   bar\r\n", []string{"SET", "foo", "bar"}},
+		{"PING\n", []string{"PING"}},
+		{"\r\n", []string{}},
+	}
+	for _, c := range cases {
+		got, err := readCommand(bufio.NewReader(strings.NewReader(c.in)))
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if len(got) != 0 || len(c.want) != 0 {
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%q: got %q, expected %q", c.in, got, c.want)
+			}
+		}
+	}
+}
+
+func TestReadCommandErrors(t *testing.T) {
+	for _, in := range []string{
+		"*x\r\n",
+		"*-1\r\n",
+		"*1\r\n+GET\r\n",
+		"*1\r\n$-1\r\n",
+		"*1\r\n$3\r\nGETX\r\n",
+		"*1\r\n$1048577\r\n",
+	} {
+		_, err := readCommand(bufio.NewReader(strings.NewReader(in)))
+		var perr protocolError
+		if !errors.As(err, &perr) {
+			t.Errorf("%q: got %v, expected a protocol error", in, err)
+		}
+	}
+}
+
+func TestReadCommandTruncated(t *testing.T) {
+	// A header claiming the largest sizes allowed, followed by a few bytes,
+	// mustn't allocate what it claims
+	in := "*1048576\r\n$1048576\r\nabc"
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := readCommand(bufio.NewReader(strings.NewReader(in)))
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 256<<10 {
+		t.Errorf("allocated %d bytes for a truncated request", n)
+	}
+}
+
+func TestWriterProtocols(t *testing.T) {
+	for _, c := range []struct {
+		proto int
+		want  string
+	}{
+		{2, "$-1\r\n*2\r\n$1\r\nk\r\n:1\r\n"},
+		{3, "_\r\n%1\r\n$1\r\nk\r\n:1\r\n"},
+	} {
+		var b bytes.Buffer
+		w := &writer{Writer: bufio.NewWriter(&b), proto: c.proto}
+		w.null()
+		w.mapHeader(1)
+		w.bulk("k")
+		w.int(1)
+		w.Flush()
+		if b.String() != c.want {
+			t.Errorf("RESP%d: got %q, expected %q", c.proto, b.String(), c.want)
+		}
+	}
+}
@@ -0,0 +1,648 @@
+// Package resp serves a cache.Cache over the Redis serialization protocol
+// (RESP2 and RESP3), so that redis-cli and Redis client libraries can be used
+// to inspect and modify a Go program's cache.
+//
+// Only a subset of the Redis string commands is supported. Values set through
+// the protocol are stored as strings; items set by Go code are visible to
+// clients if they are strings, []byte, integers or floats, and other items
+// are reported as holding the wrong type.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+	"go.uber.org/atomic"
+)
+
+// redisVersion is the Redis version reported to clients, some of which use it
+// to decide which commands to send.
+const redisVersion = "7.0.0"
+
+// ErrServerClosed is returned by Serve and ListenAndServe after a call to
+// Close.
+var ErrServerClosed = errors.New("resp: server closed")
+
+var (
+	errNotInteger = errors.New("ERR value is not an integer or out of range")
+	errOverflow   = errors.New("ERR increment or decrement would overflow")
+	errWrongType  = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errSyntax     = errors.New("ERR syntax error")
+)
+
+// A Server serves a cache over RESP.
+type Server struct {
+	c     *cache.Cache
+	start time.Time
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+
+	connectedClients atomic.Int64
+	totalConnections atomic.Uint64
+	totalCommands    atomic.Uint64
+	keyspaceHits     atomic.Uint64
+	keyspaceMisses   atomic.Uint64
+}
+
+// Returns a server backed by c.
+func New(c *cache.Cache) *Server {
+	return &Server{
+		c:         c,
+		start:     time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Listens on the given network and address, and serves connections until
+// Close is called. See Serve.
+func (s *Server) ListenAndServe(network, address string) error {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Accepts connections on l and serves each of them in its own goroutine.
+// Serve always returns a non-nil error and closes l; after Close it returns
+// ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		id, ok := s.track(conn)
+		if !ok {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn, id)
+	}
+}
+
+// Closes every listener and connection of the server.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// track registers a new connection, and returns its client ID.
+func (s *Server) track(conn net.Conn) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, false
+	}
+	s.conns[conn] = struct{}{}
+	s.connectedClients.Inc()
+	return s.totalConnections.Inc(), true
+}
+
+func (s *Server) serveConn(conn net.Conn, id uint64) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.connectedClients.Dec()
+		conn.Close()
+	}()
+
+	r := bufio.NewReaderSize(conn, maxInlineLength)
+	w := &writer{Writer: bufio.NewWriter(conn), proto: 2}
+	for {
+		args, err := readCommand(r)
+		var perr protocolError
+		if errors.As(err, &perr) {
+			w.error("ERR " + perr.Error())
+			w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		if len(args) > 0 && !s.dispatch(args, id, w) {
+			w.Flush()
+			return
+		}
+		// Only flush once the client has no more pipelined commands
+		if r.Buffered() == 0 {
+			if w.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// arity holds the number of arguments of the commands that take a fixed
+// number of them.
+var arity = map[string]int{
+	"get": 1, "incr": 1, "decr": 1, "incrby": 2, "decrby": 2,
+	"expire": 2, "ttl": 1, "pttl": 1, "keys": 1, "echo": 1, "dbsize": 0,
+}
+
+func arityError(cmd string) string {
+	return "ERR wrong number of arguments for '" + cmd + "' command"
+}
+
+// dispatch runs a single command, and returns false if the connection should
+// be closed.
+func (s *Server) dispatch(args []string, id uint64, w *writer) bool {
+	s.totalCommands.Inc()
+	cmd := strings.ToLower(args[0])
+	args = args[1:]
+
+	if n, ok := arity[cmd]; ok && len(args) != n {
+		w.error(arityError(cmd))
+		return true
+	}
+
+	switch cmd {
+	case "ping":
+		switch len(args) {
+		case 0:
+			w.simple("PONG")
+		case 1:
+			w.bulk(args[0])
+		default:
+			w.error(arityError(cmd))
+		}
+	case "echo":
+		w.bulk(args[0])
+	case "hello":
+		s.hello(args, id, w)
+	case "command":
+		// Clients such as redis-cli ask for command docs on startup, and
+		// cope with getting none
+		w.array(0)
+	case "quit":
+		w.simple("OK")
+		return false
+	case "get":
+		s.get(args[0], w)
+	case "set":
+		s.set(args, w)
+	case "del":
+		if len(args) == 0 {
+			w.error(arityError(cmd))
+			break
+		}
+		var n int64
+		for _, k := range args {
+			if _, found := s.c.GetAndDelete(k); found {
+				n++
+			}
+		}
+		w.int(n)
+	case "exists":
+		if len(args) == 0 {
+			w.error(arityError(cmd))
+			break
+		}
+		var n int64
+		for _, k := range args {
+			if _, found := s.c.Get(k); found {
+				n++
+			}
+		}
+		w.int(n)
+	case "incr", "decr", "incrby", "decrby":
+		s.incrBy(cmd, args, w)
+	case "expire":
+		s.expire(args, w)
+	case "ttl", "pttl":
+		ttl, found := s.c.TTL(args[0])
+		switch {
+		case !found:
+			w.int(-2)
+		case ttl == cache.NoExpiration:
+			w.int(-1)
+		case cmd == "ttl":
+			w.int(int64((ttl + time.Second/2) / time.Second))
+		default:
+			w.int(int64((ttl + time.Millisecond/2) / time.Millisecond))
+		}
+	case "keys":
+		var keys []string
+		s.c.Range(func(k string, item cache.Item) bool {
+			if cache.MatchGlob(args[0], k) {
+				keys = append(keys, k)
+			}
+			return true
+		})
+		w.bulks(keys)
+	case "scan":
+		s.scan(args, w)
+	case "dbsize":
+		live, _ := s.c.ItemCounts()
+		w.int(int64(live))
+	case "flushdb", "flushall":
+		if len(args) > 1 || len(args) == 1 && !strings.EqualFold(args[0], "async") && !strings.EqualFold(args[0], "sync") {
+			w.error(errSyntax.Error())
+			break
+		}
+		s.c.Flush()
+		w.simple("OK")
+	case "info":
+		w.bulk(s.info(args))
+	default:
+		var b strings.Builder
+		b.WriteString("ERR unknown command '" + cmd + "', with args beginning with: ")
+		for _, a := range args {
+			b.WriteString("'" + a + "' ")
+		}
+		w.error(b.String())
+	}
+	return true
+}
+
+// hello switches the connection's protocol version. Authentication and client
+// names aren't supported, and their options are ignored.
+func (s *Server) hello(args []string, id uint64, w *writer) {
+	if len(args) > 0 {
+		proto, err := strconv.Atoi(args[0])
+		if err != nil {
+			w.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if proto != 2 && proto != 3 {
+			w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		w.proto = proto
+	}
+	w.mapHeader(7)
+	w.bulk("server")
+	w.bulk("redis")
+	w.bulk("version")
+	w.bulk(redisVersion)
+	w.bulk("proto")
+	w.int(int64(w.proto))
+	w.bulk("id")
+	w.int(int64(id))
+	w.bulk("mode")
+	w.bulk("standalone")
+	w.bulk("role")
+	w.bulk("master")
+	w.bulk("modules")
+	w.array(0)
+}
+
+// stringValue returns the protocol view of an item.
+func stringValue(x interface{}) (string, bool) {
+	switch x := x.(type) {
+	case string:
+		return x, true
+	case []byte:
+		return string(x), true
+	case int:
+		return strconv.Itoa(x), true
+	case int8:
+		return strconv.FormatInt(int64(x), 10), true
+	case int16:
+		return strconv.FormatInt(int64(x), 10), true
+	case int32:
+		return strconv.FormatInt(int64(x), 10), true
+	case int64:
+		return strconv.FormatInt(x, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(x), 10), true
+	case uint8:
+		return strconv.FormatUint(uint64(x), 10), true
+	case uint16:
+		return strconv.FormatUint(uint64(x), 10), true
+	case uint32:
+		return strconv.FormatUint(uint64(x), 10), true
+	case uint64:
+		return strconv.FormatUint(x, 10), true
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+func (s *Server) get(k string, w *writer) {
+	x, found := s.c.Get(k)
+	if !found {
+		s.keyspaceMisses.Inc()
+		w.null()
+		return
+	}
+	v, ok := stringValue(x)
+	if !ok {
+		w.error(errWrongType.Error())
+		return
+	}
+	s.keyspaceHits.Inc()
+	w.bulk(v)
+}
+
+// set handles SET key value [EX seconds | PX milliseconds] [NX | XX].
+func (s *Server) set(args []string, w *writer) {
+	if len(args) < 2 {
+		w.error(arityError("set"))
+		return
+	}
+	k, v := args[0], args[1]
+	d := cache.NoExpiration
+	var hasExpiry, nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "EX", "PX":
+			if hasExpiry || i+1 == len(args) {
+				w.error(errSyntax.Error())
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				w.error(errNotInteger.Error())
+				return
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > int64(math.MaxInt64/unit) {
+				w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			d = time.Duration(n) * unit
+			hasExpiry = true
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			w.error(errSyntax.Error())
+			return
+		}
+	}
+	switch {
+	case nx && xx:
+		w.error(errSyntax.Error())
+		return
+	case nx:
+		if s.c.Add(k, v, d) != nil {
+			w.null()
+			return
+		}
+	case xx:
+		if s.c.Replace(k, v, d) != nil {
+			w.null()
+			return
+		}
+	default:
+		s.c.Set(k, v, d)
+	}
+	w.simple("OK")
+}
+
+// integerValue returns the value of an item that INCRBY can operate on.
+func integerValue(x interface{}) (int64, error) {
+	switch x := x.(type) {
+	case int:
+		return int64(x), nil
+	case int64:
+		return x, nil
+	case string, []byte:
+		v, _ := stringValue(x)
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, errNotInteger
+		}
+		return n, nil
+	}
+	return 0, errWrongType
+}
+
+// incrBy handles INCR, DECR, INCRBY and DECRBY. A missing key is treated as
+// 0, and an existing item keeps its expiration. The result is stored as an
+// int64, or as an int if the item was an int.
+func (s *Server) incrBy(cmd string, args []string, w *writer) {
+	k := args[0]
+	n := int64(1)
+	if len(args) == 2 {
+		var err error
+		n, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			w.error(errNotInteger.Error())
+			return
+		}
+	}
+	if cmd == "decr" || cmd == "decrby" {
+		if n == math.MinInt64 {
+			w.error("ERR decrement would overflow")
+			return
+		}
+		n = -n
+	}
+
+	var r int64
+	_, _, err := s.c.TryUpdate(k, func(old interface{}, exists bool) (interface{}, time.Duration, bool, error) {
+		d := cache.NoExpiration
+		if !exists {
+			r = n
+			return r, d, true, nil
+		}
+		v, err := integerValue(old)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if n > 0 && v > math.MaxInt64-n || n < 0 && v < math.MinInt64-n {
+			return nil, 0, false, errOverflow
+		}
+		// TTL doesn't write, so it is safe to call while the key is locked
+		if ttl, found := s.c.TTL(k); found && ttl != cache.NoExpiration {
+			d = ttl
+			if d == 0 {
+				d = time.Nanosecond
+			}
+		}
+		r = v + n
+		if _, ok := old.(int); ok && int64(int(r)) == r {
+			return int(r), d, true, nil
+		}
+		return r, d, true, nil
+	})
+	if err != nil {
+		w.error(err.Error())
+		return
+	}
+	w.int(r)
+}
+
+// expire handles EXPIRE key seconds. A non-positive timeout deletes the key.
+func (s *Server) expire(args []string, w *writer) {
+	k := args[0]
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || n > int64(math.MaxInt64/time.Second) {
+		w.error(errNotInteger.Error())
+		return
+	}
+	if n <= 0 {
+		if _, found := s.c.GetAndDelete(k); found {
+			w.int(1)
+		} else {
+			w.int(0)
+		}
+		return
+	}
+	if s.c.Touch(k, time.Duration(n)*time.Second) != nil {
+		w.int(0)
+		return
+	}
+	w.int(1)
+}
+
+// scan handles SCAN cursor [MATCH pattern] [COUNT count].
+func (s *Server) scan(args []string, w *writer) {
+	if len(args) == 0 {
+		w.error(arityError("scan"))
+		return
+	}
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		w.error("ERR invalid cursor")
+		return
+	}
+	pattern := ""
+	count := 10
+	for i := 1; i < len(args); i++ {
+		if i+1 == len(args) {
+			w.error(errSyntax.Error())
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil {
+				w.error(errNotInteger.Error())
+				return
+			}
+			if count < 1 {
+				w.error(errSyntax.Error())
+				return
+			}
+		default:
+			w.error(errSyntax.Error())
+			return
+		}
+		i++
+	}
+	keys, next := s.c.Scan(cursor, count, pattern)
+	w.array(2)
+	w.bulk(strconv.FormatUint(next, 10))
+	w.bulks(keys)
+}
+
+// info returns the INFO text for the requested sections, or the default
+// sections if none are given.
+func (s *Server) info(sections []string) string {
+	all := len(sections) == 0
+	want := make(map[string]bool)
+	for _, sec := range sections {
+		sec = strings.ToLower(sec)
+		if sec == "all" || sec == "default" || sec == "everything" {
+			all = true
+		}
+		want[sec] = true
+	}
+
+	var b strings.Builder
+	section := func(name string, fields ...string) {
+		if !all && !want[strings.ToLower(name)] {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + name + "\r\n")
+		for _, f := range fields {
+			b.WriteString(f + "\r\n")
+		}
+	}
+	itoa := func(n uint64) string {
+		return strconv.FormatUint(n, 10)
+	}
+
+	section("Server",
+		"redis_version:"+redisVersion,
+		"redis_mode:standalone",
+		"process_id:"+strconv.Itoa(os.Getpid()),
+		"uptime_in_seconds:"+itoa(uint64(time.Since(s.start)/time.Second)),
+	)
+	section("Clients",
+		"connected_clients:"+strconv.FormatInt(s.connectedClients.Load(), 10),
+	)
+	section("Stats",
+		"total_connections_received:"+itoa(s.totalConnections.Load()),
+		"total_commands_processed:"+itoa(s.totalCommands.Load()),
+		"keyspace_hits:"+itoa(s.keyspaceHits.Load()),
+		"keyspace_misses:"+itoa(s.keyspaceMisses.Load()),
+	)
+
+	var keys, expires uint64
+	s.c.Range(func(k string, item cache.Item) bool {
+		keys++
+		if item.Expiration > 0 {
+			expires++
+		}
+		return true
+	})
+	var keyspace []string
+	if keys > 0 {
+		keyspace = append(keyspace, "db0:keys="+itoa(keys)+",expires="+itoa(expires)+",avg_ttl=0")
+	}
+	section("Keyspace", keyspace...)
+	return b.String()
+}
@@ -0,0 +1,325 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+// client is a minimal RESP client. Replies are decoded into string (simple
+// and bulk strings), int64, nil, []interface{} (arrays, and maps as flat
+// arrays) or a respError.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+type respError string
+
+func startServer(t *testing.T) (*cache.Cache, *client) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cache.New(cache.DefaultExpiration, 0)
+	s := New(c)
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return c, dial(t, l.Addr().String())
+}
+
+func dial(t *testing.T, addr string) *client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *client) do(args ...string) interface{} {
+	c.t.Helper()
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		b.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.read()
+}
+
+func (c *client) read() interface{} {
+	c.t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return respError(line[1:])
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '_':
+		return nil
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(b[:n])
+	case '*', '%':
+		n, _ := strconv.Atoi(line[1:])
+		if line[0] == '%' {
+			n *= 2
+		}
+		a := []interface{}{}
+		for i := 0; i < n; i++ {
+			a = append(a, c.read())
+		}
+		return a
+	}
+	c.t.Fatalf("Unexpected reply %q", line)
+	return nil
+}
+
+func (c *client) expect(want interface{}, args ...string) {
+	c.t.Helper()
+	if got := c.do(args...); !reflect.DeepEqual(got, want) {
+		c.t.Errorf("%v: got %#v, expected %#v", args, got, want)
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	tc, c := startServer(t)
+
+	c.expect(nil, "GET", "foo")
+	c.expect("OK", "SET", "foo", "bar")
+	c.expect("bar", "get", "foo")
+	c.expect(nil, "SET", "foo", "baz", "NX")
+	c.expect("OK", "SET", "new", "1", "NX")
+	c.expect(nil, "SET", "missing", "1", "XX")
+	c.expect("OK", "SET", "foo", "qux", "XX")
+	c.expect("qux", "GET", "foo")
+	c.expect(respError(errSyntax.Error()), "SET", "foo", "x", "NX", "XX")
+	c.expect(respError("ERR invalid expire time in 'set' command"), "SET", "foo", "x", "EX", "0")
+
+	c.expect("OK", "SET", "ex", "1", "EX", "100")
+	if ttl, _ := tc.TTL("ex"); ttl <= 99*time.Second || ttl > 100*time.Second {
+		t.Error("Unexpected TTL for EX:", ttl)
+	}
+	c.expect("OK", "SET", "px", "1", "PX", "1500")
+	if ttl, _ := tc.TTL("px"); ttl <= time.Second || ttl > 1500*time.Millisecond {
+		t.Error("Unexpected TTL for PX:", ttl)
+	}
+	c.expect("OK", "SET", "foo", "bar")
+	if ttl, _ := tc.TTL("foo"); ttl != cache.NoExpiration {
+		t.Error("SET without EX set an expiration:", ttl)
+	}
+
+	tc.Set("int", 42, cache.DefaultExpiration)
+	tc.Set("struct", struct{}{}, cache.DefaultExpiration)
+	c.expect("42", "GET", "int")
+	c.expect(respError(errWrongType.Error()), "GET", "struct")
+}
+
+func TestDelExists(t *testing.T) {
+	_, c := startServer(t)
+
+	c.do("SET", "a", "1")
+	c.do("SET", "b", "2")
+	c.expect(int64(3), "EXISTS", "a", "b", "a", "c")
+	c.expect(int64(2), "DEL", "a", "b", "c")
+	c.expect(int64(0), "EXISTS", "a", "b")
+}
+
+func TestIncrBy(t *testing.T) {
+	tc, c := startServer(t)
+
+	c.expect(int64(5), "INCRBY", "n", "5")
+	c.expect(int64(6), "INCR", "n")
+	c.expect(int64(3), "DECRBY", "n", "3")
+	c.expect(int64(2), "DECR", "n")
+	c.expect("2", "GET", "n")
+
+	c.do("SET", "s", "10", "EX", "100")
+	c.expect(int64(15), "INCRBY", "s", "5")
+	if ttl, _ := tc.TTL("s"); ttl <= 99*time.Second {
+		t.Error("INCRBY didn't keep the expiration:", ttl)
+	}
+
+	c.do("SET", "big", "9223372036854775807")
+	c.expect(respError(errOverflow.Error()), "INCRBY", "big", "1")
+	c.expect("9223372036854775807", "GET", "big")
+	c.do("SET", "word", "abc", "EX", "100")
+	_, version, _ := tc.GetWithVersion("word")
+	c.expect(respError(errNotInteger.Error()), "INCRBY", "word", "1")
+	if _, v, _ := tc.GetWithVersion("word"); v != version {
+		t.Error("INCRBY rewrote a value that isn't an integer")
+	}
+	c.expect(respError(errNotInteger.Error()), "INCRBY", "n", "x")
+
+	tc.Set("goint", 1, cache.DefaultExpiration)
+	c.expect(int64(2), "INCR", "goint")
+	if x, _ := tc.Get("goint"); x != 2 {
+		t.Error("goint is not the int 2:", x)
+	}
+}
+
+func TestExpireTTL(t *testing.T) {
+	_, c := startServer(t)
+
+	c.expect(int64(-2), "TTL", "foo")
+	c.expect(int64(0), "EXPIRE", "foo", "10")
+	c.do("SET", "foo", "bar")
+	c.expect(int64(-1), "TTL", "foo")
+	c.expect(int64(1), "EXPIRE", "foo", "10")
+	c.expect(int64(10), "TTL", "foo")
+	if ms := c.do("PTTL", "foo").(int64); ms <= 9000 || ms > 10000 {
+		t.Error("Unexpected PTTL:", ms)
+	}
+	c.expect(int64(1), "EXPIRE", "foo", "-1")
+	c.expect(nil, "GET", "foo")
+}
+
+func TestKeysScan(t *testing.T) {
+	_, c := startServer(t)
+
+	for i := 0; i < 25; i++ {
+		c.do("SET", "user:"+strconv.Itoa(i), "x")
+	}
+	c.do("SET", "other", "x")
+
+	keys := c.do("KEYS", "user:*").([]interface{})
+	if len(keys) != 25 {
+		t.Error("KEYS returned", len(keys), "keys")
+	}
+
+	var scanned []string
+	cursor := "0"
+	for {
+		reply := c.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "7").([]interface{})
+		for _, k := range reply[1].([]interface{}) {
+			scanned = append(scanned, k.(string))
+		}
+		cursor = reply[0].(string)
+		if cursor == "0" {
+			break
+		}
+	}
+	sort.Strings(scanned)
+	if len(scanned) != 25 || scanned[0] != "user:0" {
+		t.Error("SCAN returned", scanned)
+	}
+	c.expect(respError(errSyntax.Error()), "SCAN", "0", "COUNT")
+}
+
+func TestFlushInfo(t *testing.T) {
+	tc, c := startServer(t)
+	tc.Namespace("ns").Set("a", 1, cache.DefaultExpiration)
+
+	c.do("SET", "a", "1", "EX", "100")
+	c.do("SET", "b", "2")
+	c.do("GET", "a")
+	c.do("GET", "missing")
+
+	info := c.do("INFO").(string)
+	for _, want := range []string{"# Server", "redis_version:", "connected_clients:1", "keyspace_hits:1", "keyspace_misses:1", "db0:keys=2,expires=1"} {
+		if !strings.Contains(info, want) {
+			t.Errorf("INFO doesn't contain %q:\n%s", want, info)
+		}
+	}
+	if info := c.do("INFO", "keyspace").(string); strings.Contains(info, "# Server") {
+		t.Error("INFO keyspace contains the server section")
+	}
+
+	c.expect(int64(2), "DBSIZE")
+	c.expect("OK", "FLUSHDB")
+	c.expect(int64(0), "DBSIZE")
+}
+
+func TestHello(t *testing.T) {
+	_, c := startServer(t)
+
+	c.expect("PONG", "PING")
+	c.expect("hi", "PING", "hi")
+	c.expect([]interface{}{}, "COMMAND", "DOCS")
+
+	reply := c.do("HELLO", "3").([]interface{})
+	if reply[4] != "proto" || reply[5] != int64(3) {
+		t.Error("Unexpected HELLO reply:", reply)
+	}
+	// In RESP3 a null is sent as '_'
+	if _, err := c.conn.Write([]byte("*2\r\n$3\r\nGET\r\n$7\r\nmissing\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := c.r.ReadString('\n'); line != "_\r\n" {
+		t.Errorf("Null in RESP3 is %q", line)
+	}
+	c.expect(respError("NOPROTO unsupported protocol version"), "HELLO", "4")
+}
+
+func TestErrors(t *testing.T) {
+	_, c := startServer(t)
+
+	c.expect(respError("ERR unknown command 'bogus', with args beginning with: 'a' "), "BOGUS", "a")
+	c.expect(respError(arityError("get")), "GET")
+	c.expect(respError(arityError("del")), "DEL")
+
+	// Inline commands are accepted too
+	if _, err := c.conn.Write([]byte("SET inline value\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.read(); got != "OK" {
+		t.Error("Inline SET returned", got)
+	}
+	c.expect("value", "GET", "inline")
+
+	if _, err := c.conn.Write([]byte("*1\r\n+GET\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.read().(respError); !ok || !strings.HasPrefix(string(got), "ERR Protocol error") {
+		t.Error("Malformed request returned", got)
+	}
+}
+
+func TestClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(cache.New(cache.DefaultExpiration, 0))
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+
+	c := dial(t, l.Addr().String())
+	c.expect("PONG", "PING")
+
+	s.Close()
+	if err := <-done; !errors.Is(err, ErrServerClosed) {
+		t.Error("Serve returned", err)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Error("Connection is still open after Close")
+	}
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// Returns a page of at most count unexpired keys matching the Redis-style glob
+// pattern (an empty pattern matches every key), and the cursor to pass to the
+// next call. Start a scan with cursor 0; a returned cursor of 0 means the scan
+// is complete.
+//
+// Keys are visited in order of their hash, so a scan only ever holds one page
+// of keys in memory. Every key present for the whole duration of a scan is
+// returned at least once; keys added or removed during the scan may or may
+// not be. A page may exceed count in the unlikely event of hash collisions.
+// If count is less than one, a page size of 10 is used.
+//
+// Scan bounds memory, not time: since the cache keeps no ordered index, every
+// call walks all the items, so a complete scan of n items in pages of count
+// keys takes O(n²/count) time. To visit every item in one pass, use Range.
+func (c *cache) Scan(cursor uint64, count int, pattern string) ([]string, uint64) {
+	if count < 1 {
+		count = 10
+	}
+	page := &scanPage{keys: make(map[uint64][]string)}
+
+	c.Range(func(k string, item Item) bool {
+		if pattern != "" && !MatchGlob(pattern, k) {
+			return true
+		}
+		h := scanHash(k)
+		if h < cursor {
+			return true
+		}
+		if _, ok := page.keys[h]; ok {
+			page.keys[h] = append(page.keys[h], k)
+			return true
+		}
+		if page.Len() < count {
+			heap.Push(page, h)
+			page.keys[h] = []string{k}
+			return true
+		}
+		page.truncated = true
+		if h < page.hashes[0] {
+			delete(page.keys, heap.Pop(page).(uint64))
+			heap.Push(page, h)
+			page.keys[h] = []string{k}
+		}
+		return true
+	})
+
+	hashes := append([]uint64(nil), page.hashes...)
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	var keys []string
+	for _, h := range hashes {
+		keys = append(keys, page.keys[h]...)
+	}
+
+	if !page.truncated || len(hashes) == 0 || hashes[len(hashes)-1] == math.MaxUint64 {
+		return keys, 0
+	}
+	return keys, hashes[len(hashes)-1] + 1
+}
+
+func scanHash(k string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(k))
+	return h.Sum64()
+}
+
+// scanPage is a max-heap of the smallest key hashes seen so far, along with
+// the keys having those hashes.
+type scanPage struct {
+	hashes    []uint64
+	keys      map[uint64][]string
+	truncated bool
+}
+
+func (p *scanPage) Len() int           { return len(p.hashes) }
+func (p *scanPage) Less(i, j int) bool { return p.hashes[i] > p.hashes[j] }
+func (p *scanPage) Swap(i, j int)      { p.hashes[i], p.hashes[j] = p.hashes[j], p.hashes[i] }
+func (p *scanPage) Push(x interface{}) { p.hashes = append(p.hashes, x.(uint64)) }
+func (p *scanPage) Pop() interface{} {
+	h := p.hashes[len(p.hashes)-1]
+	p.hashes = p.hashes[:len(p.hashes)-1]
+	return h
+}
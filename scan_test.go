@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	for i := 0; i < 1000; i++ {
+		tc.Set("user:"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	for i := 0; i < 100; i++ {
+		tc.Set("order:"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	tc.Set("user:expired", 0, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+
+	seen := make(map[string]bool)
+	var cursor uint64
+	pages := 0
+	for {
+		var keys []string
+		keys, cursor = tc.Scan(cursor, 64, "user:*")
+		if len(keys) > 64 {
+			t.Errorf("Scan returned %d keys, expected at most 64", len(keys))
+		}
+		for _, k := range keys {
+			if seen[k] {
+				t.Error("Scan returned a key twice:", k)
+			}
+			seen[k] = true
+		}
+		pages++
+		if cursor == 0 {
+			break
+		}
+		if pages > 100 {
+			t.Fatal("Scan did not terminate")
+		}
+	}
+	if len(seen) != 1000 {
+		t.Errorf("Scan returned %d keys, expected 1000", len(seen))
+	}
+	if seen["user:expired"] {
+		t.Error("Scan returned an expired key")
+	}
+	if pages < 16 {
+		t.Errorf("Scan returned %d pages, expected at least 16", pages)
+	}
+}
+
+func TestScanEmpty(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	keys, cursor := tc.Scan(0, 10, "")
+	if len(keys) != 0 || cursor != 0 {
+		t.Error("Scan of an empty cache returned", keys, cursor)
+	}
+}
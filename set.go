@@ -0,0 +1,334 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Sets and sorted sets are stored as StringSet and SortedSet values, so they
+// can also be read with Get and serialized along with the other items. As
+// with lists, the set operations never modify a stored value in place; they
+// store a modified copy, so values returned by Get stay valid. Callers must
+// not modify them either.
+//
+// Copying makes every change to a set take time and memory proportional to
+// its size: SAdd and SRem copy the members, and ZAdd and ZIncrBy copy both
+// the scores and the ordered members. SAdd and SRem don't copy a set they
+// leave unchanged, nor does ZAdd without members. Large sets that change often are better kept in a structure of the
+// caller's own, stored once under a key.
+//
+// The cache has no size limit and doesn't account for the memory its items
+// use, so a set counts as a single item however many members it has.
+
+// A StringSet is the value stored by SAdd: the set of its members. It is
+// named apart from the Set method, which stores an item of any type.
+type StringSet map[string]struct{}
+
+func (s StringSet) clone() StringSet {
+	ns := make(StringSet, len(s)+1)
+	for m := range s {
+		ns[m] = struct{}{}
+	}
+	return ns
+}
+
+// A ZMember is a member of a sorted set and its score.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// A SortedSet is the value stored by ZAdd.
+type SortedSet struct {
+	// Scores maps the members to their scores.
+	Scores map[string]float64
+	// Members holds the members and their scores, ordered by score, then
+	// by member.
+	Members []ZMember
+}
+
+func (z SortedSet) clone() *SortedSet {
+	nz := &SortedSet{
+		Scores:  make(map[string]float64, len(z.Scores)+1),
+		Members: make([]ZMember, len(z.Members), len(z.Members)+1),
+	}
+	for m, score := range z.Scores {
+		nz.Scores[m] = score
+	}
+	copy(nz.Members, z.Members)
+	return nz
+}
+
+func zless(a, b ZMember) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	return a.Member < b.Member
+}
+
+// search returns the index of m in Members, or where it would be inserted.
+func (z *SortedSet) search(m ZMember) int {
+	return sort.Search(len(z.Members), func(i int) bool {
+		return !zless(z.Members[i], m)
+	})
+}
+
+func (z *SortedSet) remove(member string) {
+	score, ok := z.Scores[member]
+	if !ok {
+		return
+	}
+	i := z.search(ZMember{member, score})
+	if i == len(z.Members) || z.Members[i].Member != member {
+		panic("cache: sorted set order is inconsistent")
+	}
+	z.Members = append(z.Members[:i], z.Members[i+1:]...)
+	delete(z.Scores, member)
+}
+
+func (z *SortedSet) set(member string, score float64) {
+	z.remove(member)
+	m := ZMember{member, score}
+	i := z.search(m)
+	z.Members = append(z.Members, ZMember{})
+	copy(z.Members[i+1:], z.Members[i:])
+	z.Members[i] = m
+	z.Scores[member] = score
+}
+
+// replaceCollection replaces the value stored under k with the one returned
+// by fn, keeping its expiration. fn must not modify the value it is passed,
+// which readers may still be using, but return a modified copy, or nil if it
+// changed nothing. If there is no unexpired item under k, fn is passed the
+// value returned by create, and the result is stored with the default
+// expiration; if create is nil, an error wrapping ErrNotFound is returned
+// instead.
+func (c *cache) replaceCollection(k string, create func() interface{}, fn func(x interface{}) (interface{}, error)) error {
+	_, _, err := c.modify(k, func(item Item, found bool) (Item, bool, error) {
+		if !found {
+			if create == nil {
+				return item, false, notFoundError(k)
+			}
+			item = Item{Object: create(), Expiration: c.expiration(DefaultExpiration)}
+		}
+		x, err := fn(item.Object)
+		if err != nil {
+			return item, false, err
+		}
+		if x == nil {
+			if found {
+				return item, true, errUnchanged
+			}
+			return item, true, nil
+		}
+		item.Object = x
+		return item, true, nil
+	})
+	if err == errUnchanged {
+		err = nil
+	}
+	return err
+}
+
+// getCollection returns the value stored under k, or the value returned by
+// create if there is no unexpired item.
+func (c *cache) getCollection(k string, create func() interface{}) interface{} {
+	x, found := c.get(k)
+	if !found {
+		return create()
+	}
+	return x
+}
+
+func newSet() interface{} {
+	return StringSet{}
+}
+
+func newSortedSet() interface{} {
+	return SortedSet{}
+}
+
+// Add members to the set stored under k, creating it with the default
+// expiration if it doesn't exist or has expired. Returns the number of
+// members that weren't already in the set, or an error wrapping
+// ErrTypeMismatch if k holds something other than a StringSet.
+func (c *cache) SAdd(k string, members ...string) (int, error) {
+	var n int
+	err := c.replaceCollection(k, newSet, func(x interface{}) (interface{}, error) {
+		s, ok := x.(StringSet)
+		if !ok {
+			return nil, typeMismatchError(k, "StringSet")
+		}
+		n = 0
+		var ns StringSet
+		for _, m := range members {
+			if _, ok := s[m]; ok {
+				continue
+			}
+			if ns == nil {
+				ns = s.clone()
+			}
+			if _, ok := ns[m]; !ok {
+				ns[m] = struct{}{}
+				n++
+			}
+		}
+		if ns == nil {
+			return nil, nil
+		}
+		return ns, nil
+	})
+	return n, err
+}
+
+// Remove members from the set stored under k. Returns the number of members
+// that were removed. The set keeps its expiration, even once empty.
+func (c *cache) SRem(k string, members ...string) (int, error) {
+	var n int
+	err := c.replaceCollection(k, nil, func(x interface{}) (interface{}, error) {
+		s, ok := x.(StringSet)
+		if !ok {
+			return nil, typeMismatchError(k, "StringSet")
+		}
+		n = 0
+		var ns StringSet
+		for _, m := range members {
+			if _, ok := s[m]; !ok {
+				continue
+			}
+			if ns == nil {
+				ns = s.clone()
+			}
+			if _, ok := ns[m]; ok {
+				delete(ns, m)
+				n++
+			}
+		}
+		if ns == nil {
+			return nil, nil
+		}
+		return ns, nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	return n, err
+}
+
+// Reports whether member is in the set stored under k.
+func (c *cache) SIsMember(k string, member string) (bool, error) {
+	s, ok := c.getCollection(k, newSet).(StringSet)
+	if !ok {
+		return false, typeMismatchError(k, "StringSet")
+	}
+	_, is := s[member]
+	return is, nil
+}
+
+// Returns the members of the set stored under k, in no particular order. A
+// missing set is treated as empty.
+func (c *cache) SMembers(k string) ([]string, error) {
+	s, ok := c.getCollection(k, newSet).(StringSet)
+	if !ok {
+		return nil, typeMismatchError(k, "StringSet")
+	}
+	members := make([]string, 0, len(s))
+	for m := range s {
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// Add members to the sorted set stored under k, or update their scores if
+// they are already in it, creating the set with the default expiration if it
+// doesn't exist or has expired. Returns the number of members that weren't
+// already in the set, or an error wrapping ErrTypeMismatch if k holds
+// something other than a SortedSet, or ErrNaN if a score is NaN. Without
+// members, ZAdd doesn't create the set.
+func (c *cache) ZAdd(k string, members ...ZMember) (int, error) {
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, nanError(k)
+		}
+	}
+	if len(members) == 0 {
+		if x, found := c.Get(k); found {
+			if _, ok := x.(SortedSet); !ok {
+				return 0, typeMismatchError(k, "SortedSet")
+			}
+		}
+		return 0, nil
+	}
+	var n int
+	err := c.replaceCollection(k, newSortedSet, func(x interface{}) (interface{}, error) {
+		z, ok := x.(SortedSet)
+		if !ok {
+			return nil, typeMismatchError(k, "SortedSet")
+		}
+		n = 0
+		nz := z.clone()
+		for _, m := range members {
+			if _, ok := nz.Scores[m.Member]; !ok {
+				n++
+			}
+			nz.set(m.Member, m.Score)
+		}
+		return *nz, nil
+	})
+	return n, err
+}
+
+// Add incr to the score of member in the sorted set stored under k, adding
+// the member with a score of incr if it isn't in the set. Returns the new
+// score, or an error wrapping ErrNaN if it would be NaN, as when adding
+// -Inf to +Inf.
+func (c *cache) ZIncrBy(k string, incr float64, member string) (float64, error) {
+	var score float64
+	err := c.replaceCollection(k, newSortedSet, func(x interface{}) (interface{}, error) {
+		z, ok := x.(SortedSet)
+		if !ok {
+			return nil, typeMismatchError(k, "SortedSet")
+		}
+		score = z.Scores[member] + incr
+		if math.IsNaN(score) {
+			return nil, nanError(k)
+		}
+		nz := z.clone()
+		nz.set(member, score)
+		return *nz, nil
+	})
+	return score, err
+}
+
+// Returns the members of the sorted set stored under k whose score is between
+// min and max, inclusive, ordered by score. A missing set is treated as
+// empty.
+func (c *cache) ZRangeByScore(k string, min, max float64) ([]ZMember, error) {
+	z, ok := c.getCollection(k, newSortedSet).(SortedSet)
+	if !ok {
+		return nil, typeMismatchError(k, "SortedSet")
+	}
+	i := sort.Search(len(z.Members), func(i int) bool {
+		return z.Members[i].Score >= min
+	})
+	var members []ZMember
+	for ; i < len(z.Members) && z.Members[i].Score <= max; i++ {
+		members = append(members, z.Members[i])
+	}
+	return members, nil
+}
+
+// Returns the 0-based rank of member in the sorted set stored under k, ordered
+// by ascending score, and whether the member is in the set.
+func (c *cache) ZRank(k string, member string) (int, bool, error) {
+	z, ok := c.getCollection(k, newSortedSet).(SortedSet)
+	if !ok {
+		return 0, false, typeMismatchError(k, "SortedSet")
+	}
+	score, found := z.Scores[member]
+	if !found {
+		return 0, false, nil
+	}
+	return z.search(ZMember{member, score}), true, nil
+}
@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSet(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if n, err := tc.SAdd("online", "a", "b", "a"); err != nil || n != 2 {
+		t.Fatal("SAdd failed:", n, err)
+	}
+	if n, _ := tc.SAdd("online", "b", "c"); n != 1 {
+		t.Error("SAdd added", n, "members, expected 1")
+	}
+	if is, _ := tc.SIsMember("online", "c"); !is {
+		t.Error("c is not a member of online")
+	}
+	if n, _ := tc.SRem("online", "c", "d"); n != 1 {
+		t.Error("SRem removed", n, "members, expected 1")
+	}
+	if is, _ := tc.SIsMember("online", "c"); is {
+		t.Error("c is still a member of online")
+	}
+	members, _ := tc.SMembers("online")
+	sort.Strings(members)
+	if !reflect.DeepEqual(members, []string{"a", "b"}) {
+		t.Error("Unexpected members:", members)
+	}
+
+	if is, err := tc.SIsMember("missing", "a"); is || err != nil {
+		t.Error("SIsMember on a missing set returned", is, err)
+	}
+	if n, err := tc.SRem("missing", "a"); n != 0 || err != nil {
+		t.Error("SRem on a missing set returned", n, err)
+	}
+
+	tc.Set("string", "foo", DefaultExpiration)
+	if _, err := tc.SAdd("string", "a"); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("SAdd on a string returned", err)
+	}
+	if _, err := tc.SMembers("string"); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("SMembers on a string returned", err)
+	}
+}
+
+func TestSetExpiration(t *testing.T) {
+	tc := New(50*time.Millisecond, 0)
+	tc.SAdd("s", "a")
+	_, e1, found := tc.GetWithExpiration("s")
+	if !found || e1.IsZero() {
+		t.Fatal("s was not created with the default expiration")
+	}
+	tc.SAdd("s", "b")
+	if _, e2, _ := tc.GetWithExpiration("s"); !e2.Equal(e1) {
+		t.Error("SAdd changed the expiration of s")
+	}
+	<-time.After(60 * time.Millisecond)
+	if is, _ := tc.SIsMember("s", "a"); is {
+		t.Error("a is a member of an expired set")
+	}
+	if n, _ := tc.SAdd("s", "a"); n != 1 {
+		t.Error("SAdd on an expired set did not create a new one")
+	}
+}
+
+func TestSetConcurrent(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.SAdd("s", strconv.Itoa(i*100+j))
+				tc.SMembers("s")
+			}
+		}(i)
+	}
+	wg.Wait()
+	if members, _ := tc.SMembers("s"); len(members) != 800 {
+		t.Error("s does not have 800 members:", len(members))
+	}
+}
+
+func TestSortedSet(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	n, err := tc.ZAdd("board", ZMember{"a", 10}, ZMember{"b", 30}, ZMember{"c", 20})
+	if err != nil || n != 3 {
+		t.Fatal("ZAdd failed:", n, err)
+	}
+	if n, _ := tc.ZAdd("board", ZMember{"a", 40}, ZMember{"d", 5}); n != 1 {
+		t.Error("ZAdd added", n, "members, expected 1")
+	}
+	members, _ := tc.ZRangeByScore("board", 0, 100)
+	want := []ZMember{{"d", 5}, {"c", 20}, {"b", 30}, {"a", 40}}
+	if !reflect.DeepEqual(members, want) {
+		t.Error("Unexpected members:", members)
+	}
+	members, _ = tc.ZRangeByScore("board", 20, 30)
+	if !reflect.DeepEqual(members, want[1:3]) {
+		t.Error("Unexpected members between 20 and 30:", members)
+	}
+
+	if score, _ := tc.ZIncrBy("board", 30, "d"); score != 35 {
+		t.Error("d's score is not 35:", score)
+	}
+	if rank, found, _ := tc.ZRank("board", "d"); !found || rank != 2 {
+		t.Error("d's rank is not 2:", rank, found)
+	}
+	if rank, found, _ := tc.ZRank("board", "c"); !found || rank != 0 {
+		t.Error("c's rank is not 0:", rank, found)
+	}
+	if _, found, _ := tc.ZRank("board", "z"); found {
+		t.Error("z was found in board")
+	}
+	if score, _ := tc.ZIncrBy("board", 1.5, "e"); score != 1.5 {
+		t.Error("e's score is not 1.5:", score)
+	}
+
+	if _, err := tc.ZAdd("board", ZMember{"f", 1}, ZMember{"a", math.NaN()}); !errors.Is(err, ErrNaN) {
+		t.Error("ZAdd with a NaN score returned", err)
+	}
+	if _, found, _ := tc.ZRank("board", "f"); found {
+		t.Error("ZAdd with a NaN score added f")
+	}
+	tc.ZAdd("board", ZMember{"inf", math.Inf(1)})
+	if _, err := tc.ZIncrBy("board", math.Inf(-1), "inf"); !errors.Is(err, ErrNaN) {
+		t.Error("ZIncrBy to a NaN score returned", err)
+	}
+	if members, _ := tc.ZRangeByScore("board", math.Inf(-1), math.Inf(1)); len(members) != 6 {
+		t.Error("Unexpected members after NaN scores were rejected:", members)
+	}
+
+	tc.SAdd("set", "a")
+	if _, err := tc.ZAdd("set", ZMember{"a", 1}); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("ZAdd on a set returned", err)
+	}
+	if _, err := tc.ZAdd("set"); !errors.Is(err, ErrTypeMismatch) {
+		t.Error("ZAdd without members on a set returned", err)
+	}
+
+	if n, err := tc.ZAdd("empty"); n != 0 || err != nil {
+		t.Error("ZAdd without members returned", n, err)
+	}
+	if _, found := tc.Get("empty"); found {
+		t.Error("ZAdd without members created the set")
+	}
+	if n := testing.AllocsPerRun(10, func() { tc.ZAdd("board") }); n != 0 {
+		t.Error("ZAdd without members allocated", n, "times")
+	}
+}
+
+func TestSetValues(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SAdd("s", "a")
+	tc.ZAdd("z", ZMember{"a", 1})
+	x, _ := tc.Get("s")
+	y, _ := tc.Get("z")
+	tc.SAdd("s", "b")
+	tc.ZAdd("z", ZMember{"b", 2})
+	if !reflect.DeepEqual(x, StringSet{"a": {}}) {
+		t.Error("StringSet returned by Get was modified:", x)
+	}
+	if !reflect.DeepEqual(y, SortedSet{Scores: map[string]float64{"a": 1}, Members: []ZMember{{"a", 1}}}) {
+		t.Error("SortedSet returned by Get was modified:", y)
+	}
+
+	gob.Register(StringSet{})
+	gob.Register(SortedSet{})
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(tc.Items()); err != nil {
+		t.Fatal("Couldn't encode the items:", err)
+	}
+	var items map[string]Item
+	if err := gob.NewDecoder(&b).Decode(&items); err != nil {
+		t.Fatal("Couldn't decode the items:", err)
+	}
+	if !reflect.DeepEqual(items["z"].Object, SortedSet{Scores: map[string]float64{"a": 1, "b": 2}, Members: []ZMember{{"a", 1}, {"b", 2}}}) {
+		t.Error("Unexpected decoded sorted set:", items["z"].Object)
+	}
+}
@@ -0,0 +1,225 @@
+// Package sqlcache wraps a *sql.DB to cache the results of read queries in a
+// cache.Cache.
+//
+// Results are read in full and cached under keys prefixed with "sqlcache:",
+// tagged with the tables the query reads. Statements run through ExecContext
+// invalidate the cached results of the tables they write; changes made in
+// other ways must be followed by a call to Invalidate. Table names are found
+// by naive parsing of the SQL text, so results of queries reading tables
+// through views or functions must be invalidated explicitly.
+package sqlcache
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+// A DB caches the results of queries run on a database.
+type DB struct {
+	db *sql.DB
+	c  *cache.Cache
+
+	// mu guards generations, which counts the invalidations of each table.
+	// A result is only stored if none of its tables were invalidated while
+	// the query ran.
+	mu          sync.Mutex
+	generations map[string]uint64
+}
+
+// Returns a DB running queries on db and caching their results in c.
+func New(db *sql.DB, c *cache.Cache) *DB {
+	return &DB{
+		db:          db,
+		c:           c,
+		generations: make(map[string]uint64),
+	}
+}
+
+// Returns the underlying database, for running statements that aren't
+// cached. Use Invalidate after writing through it.
+func (d *DB) DB() *sql.DB {
+	return d.db
+}
+
+// Runs a query, or returns its result from the cache, caching it with the
+// cache's default expiration. See QueryContextTTL.
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	return d.QueryContextTTL(ctx, cache.DefaultExpiration, query, args...)
+}
+
+// Runs a query and caches its result for ttl (see cache.Set for the meaning
+// of ttl), or returns the result from the cache if the same query was run
+// with the same arguments before. Errors are not cached, nor are the results
+// of queries with arguments that database/sql's default conversion doesn't
+// handle, such as types known only to the driver.
+func (d *DB) QueryContextTTL(ctx context.Context, ttl time.Duration, query string, args ...interface{}) (*Rows, error) {
+	key, ok := queryKey(query, args)
+	if !ok {
+		res, err := d.query(ctx, query, args)
+		if err != nil {
+			return nil, err
+		}
+		return &Rows{res: res}, nil
+	}
+	if x, found := d.c.Get(key); found {
+		return &Rows{res: x.(*result)}, nil
+	}
+
+	names := tables(query)
+	gens := d.snapshot(names)
+	res, err := d.query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, len(names))
+	for i, name := range names {
+		tags[i] = tableTag(name)
+	}
+	d.mu.Lock()
+	if d.unchanged(names, gens) {
+		d.c.SetWithTags(key, res, ttl, tags...)
+	}
+	d.mu.Unlock()
+	return &Rows{res: res}, nil
+}
+
+// Runs a statement on the database, and invalidates the cached results of
+// the tables it names, whether or not it succeeds.
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	res, err := d.db.ExecContext(ctx, query, args...)
+	d.Invalidate(tables(query)...)
+	return res, err
+}
+
+// Deletes the cached results of every query reading any of the given tables.
+// Table names are compared case-insensitively and without their schema, so
+// invalidating "users" also invalidates queries reading "public.users".
+func (d *DB) Invalidate(tables ...string) {
+	names := make([]string, 0, len(tables))
+	d.mu.Lock()
+	for _, t := range tables {
+		name, ok := tableName(t)
+		if !ok {
+			name = strings.ToLower(t)
+		}
+		d.generations[name]++
+		names = append(names, name)
+	}
+	d.mu.Unlock()
+
+	for _, name := range names {
+		d.c.InvalidateTag(tableTag(name))
+	}
+}
+
+func (d *DB) snapshot(names []string) []uint64 {
+	gens := make([]uint64, len(names))
+	d.mu.Lock()
+	for i, name := range names {
+		gens[i] = d.generations[name]
+	}
+	d.mu.Unlock()
+	return gens
+}
+
+// unchanged reports whether none of the tables were invalidated since gens
+// was taken. d.mu must be held.
+func (d *DB) unchanged(names []string, gens []uint64) bool {
+	for i, name := range names {
+		if d.generations[name] != gens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *DB) query(ctx context.Context, query string, args []interface{}) (*result, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	res := &result{columns: columns}
+	for rows.Next() {
+		row := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		// Scanning into *interface{} copies []byte values
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		res.rows = append(res.rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// queryKey returns the cache key of a query's result. Arguments are keyed by
+// the values the driver receives, as converted by
+// driver.DefaultParameterConverter, so that e.g. int(1) and int64(1) are the
+// same but 1 and "1" are not, and pointers are keyed by what they point to.
+// Each part of the key is prefixed with its length, so that different queries
+// can't produce the same key. It returns false if an argument can't be
+// converted.
+func queryKey(query string, args []interface{}) (string, bool) {
+	var b strings.Builder
+	b.WriteString("sqlcache:query:")
+	writeKeyPart(&b, 'q', query)
+	for _, a := range args {
+		if na, ok := a.(sql.NamedArg); ok {
+			writeKeyPart(&b, '@', na.Name)
+			a = na.Value
+		}
+		v, err := driver.DefaultParameterConverter.ConvertValue(a)
+		if err != nil {
+			return "", false
+		}
+		switch v := v.(type) {
+		case nil:
+			writeKeyPart(&b, 'n', "")
+		case int64:
+			writeKeyPart(&b, 'i', strconv.FormatInt(v, 10))
+		case float64:
+			writeKeyPart(&b, 'f', strconv.FormatFloat(v, 'g', -1, 64))
+		case bool:
+			writeKeyPart(&b, 'b', strconv.FormatBool(v))
+		case []byte:
+			writeKeyPart(&b, 'x', string(v))
+		case string:
+			writeKeyPart(&b, 's', v)
+		case time.Time:
+			writeKeyPart(&b, 't', v.Format(time.RFC3339Nano))
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+func writeKeyPart(b *strings.Builder, kind byte, s string) {
+	b.WriteByte(kind)
+	b.WriteString(strconv.Itoa(len(s)))
+	b.WriteByte(':')
+	b.WriteString(s)
+}
+
+func tableTag(name string) string {
+	return "sqlcache:table:" + name
+}
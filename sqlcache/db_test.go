@@ -0,0 +1,259 @@
+package sqlcache
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/ghstahl/go-atomic-cache"
+)
+
+// fakeDB is a database/sql driver for a single users table, understanding
+// only the statements used in the tests.
+type fakeDB struct {
+	mu      sync.Mutex
+	names   map[int64]string
+	queries int
+	// block, if set, is received from before a query returns its rows
+	block chan struct{}
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.db, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	switch s.query {
+	case "UPDATE users SET name = ? WHERE id = ?":
+		s.db.names[args[1].(int64)] = args[0].(string)
+		return driver.RowsAffected(1), nil
+	case "INSERT INTO audit (msg) VALUES (?)":
+		return driver.RowsAffected(1), nil
+	}
+	return nil, errors.New("unknown statement: " + s.query)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	s.db.queries++
+	block := s.db.block
+	var rows [][]driver.Value
+	switch s.query {
+	case "SELECT id, name FROM users WHERE id = ?":
+		if name, ok := s.db.names[args[0].(int64)]; ok {
+			rows = append(rows, []driver.Value{args[0], []byte(name)})
+		}
+	case "SELECT id, name FROM users ORDER BY id":
+		for id := int64(1); id <= int64(len(s.db.names)); id++ {
+			rows = append(rows, []driver.Value{id, []byte(s.db.names[id])})
+		}
+	default:
+		s.db.mu.Unlock()
+		return nil, errors.New("unknown query: " + s.query)
+	}
+	s.db.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	i    int
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id", "name"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
+
+func newDB(t *testing.T) (*fakeDB, *DB) {
+	fdb := &fakeDB{names: map[int64]string{1: "alice", 2: "bob"}}
+	db := sql.OpenDB(fdb)
+	t.Cleanup(func() { db.Close() })
+	return fdb, New(db, cache.New(cache.DefaultExpiration, 0))
+}
+
+func queryName(t *testing.T, db *DB, id int64) string {
+	t.Helper()
+	rows, err := db.QueryContext(context.Background(), "SELECT id, name FROM users WHERE id = ?", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.Next() {
+		return ""
+	}
+	var (
+		gotID int64
+		name  string
+	)
+	if err := rows.Scan(&gotID, &name); err != nil {
+		t.Fatal(err)
+	}
+	if gotID != id {
+		t.Error("Unexpected id:", gotID)
+	}
+	return name
+}
+
+func TestQueryCaching(t *testing.T) {
+	fdb, db := newDB(t)
+
+	if name := queryName(t, db, 1); name != "alice" {
+		t.Error("Unexpected name:", name)
+	}
+	if name := queryName(t, db, 1); name != "alice" {
+		t.Error("Unexpected cached name:", name)
+	}
+	if name := queryName(t, db, 2); name != "bob" {
+		t.Error("Unexpected name:", name)
+	}
+	if fdb.queries != 2 {
+		t.Error("Database was queried", fdb.queries, "times")
+	}
+
+	_, err := db.QueryContext(context.Background(), "SELECT nonsense")
+	if err == nil {
+		t.Error("Query error was not returned")
+	}
+	db.QueryContext(context.Background(), "SELECT nonsense")
+	if fdb.queries != 4 {
+		t.Error("Query error was cached")
+	}
+}
+
+func TestQueryTTL(t *testing.T) {
+	fdb, db := newDB(t)
+	ctx := context.Background()
+	q := "SELECT id, name FROM users ORDER BY id"
+
+	if _, err := db.QueryContextTTL(ctx, 5*time.Millisecond, q); err != nil {
+		t.Fatal(err)
+	}
+	db.QueryContextTTL(ctx, 5*time.Millisecond, q)
+	<-time.After(10 * time.Millisecond)
+	rows, _ := db.QueryContextTTL(ctx, 5*time.Millisecond, q)
+	if fdb.queries != 2 {
+		t.Error("Database was queried", fdb.queries, "times")
+	}
+	if rows.Len() != 2 {
+		t.Error("Unexpected number of rows:", rows.Len())
+	}
+}
+
+func TestExecInvalidates(t *testing.T) {
+	fdb, db := newDB(t)
+	ctx := context.Background()
+
+	queryName(t, db, 1)
+	if _, err := db.ExecContext(ctx, "INSERT INTO audit (msg) VALUES (?)", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	queryName(t, db, 1)
+	if fdb.queries != 1 {
+		t.Error("Writing another table invalidated users")
+	}
+
+	if _, err := db.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", "carol", int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	if name := queryName(t, db, 1); name != "carol" {
+		t.Error("Stale name after update:", name)
+	}
+
+	// Writes made directly need explicit invalidation
+	db.DB().ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", "dave", int64(1))
+	if name := queryName(t, db, 1); name != "carol" {
+		t.Error("Unexpected name:", name)
+	}
+	db.Invalidate("Public.USERS")
+	if name := queryName(t, db, 1); name != "dave" {
+		t.Error("Stale name after Invalidate:", name)
+	}
+}
+
+func TestInvalidateDuringQuery(t *testing.T) {
+	fdb, db := newDB(t)
+	ctx := context.Background()
+	block := make(chan struct{})
+	fdb.block = block
+
+	done := make(chan string)
+	go func() {
+		done <- queryName(t, db, 1)
+	}()
+	// Update the name after the query has read it, but before it returns
+	for {
+		fdb.mu.Lock()
+		n := fdb.queries
+		fdb.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", "carol", int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	close(block)
+	if name := <-done; name != "alice" {
+		t.Error("Unexpected name:", name)
+	}
+	if name := queryName(t, db, 1); name != "carol" {
+		t.Error("Result of a query racing an update was cached:", name)
+	}
+}
+
+func TestQueryKey(t *testing.T) {
+	one := int64(1)
+	for _, c := range []struct {
+		a, b []interface{}
+		same bool
+	}{
+		{[]interface{}{"a\x00string:b"}, []interface{}{"a", "b"}, false},
+		{[]interface{}{"1"}, []interface{}{1}, false},
+		{[]interface{}{[]byte("a")}, []interface{}{"a"}, false},
+		{[]interface{}{nil}, []interface{}{""}, false},
+		{[]interface{}{sql.Named("a", 1)}, []interface{}{1}, false},
+		{[]interface{}{int32(1)}, []interface{}{int64(1)}, true},
+		{[]interface{}{&one}, []interface{}{new(int64)}, false},
+		{[]interface{}{&one}, []interface{}{int64(1)}, true},
+	} {
+		ka, _ := queryKey("SELECT ?", c.a)
+		kb, _ := queryKey("SELECT ?", c.b)
+		if (ka == kb) != c.same {
+			t.Errorf("Keys of %#v and %#v: %q, %q", c.a, c.b, ka, kb)
+		}
+	}
+	if _, ok := queryKey("SELECT ?", []interface{}{struct{}{}}); ok {
+		t.Error("Got a key for an argument that can't be converted")
+	}
+}
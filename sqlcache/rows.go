@@ -0,0 +1,195 @@
+package sqlcache
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// A result is the materialized result of a query. Results are shared by all
+// the Rows reading them, and never modified.
+type result struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+// Rows is the result of a query, read from the cache or from the database.
+// Its methods mirror those of sql.Rows: call Next before each Scan.
+type Rows struct {
+	res *result
+	i   int
+}
+
+// Returns the column names.
+func (r *Rows) Columns() []string {
+	return append([]string(nil), r.res.columns...)
+}
+
+// Returns the number of rows in the result.
+func (r *Rows) Len() int {
+	return len(r.res.rows)
+}
+
+// Prepares the next row for reading with Scan. Returns false when there are
+// no more rows.
+func (r *Rows) Next() bool {
+	if r.i >= len(r.res.rows) {
+		return false
+	}
+	r.i++
+	return true
+}
+
+// Copies the columns of the current row into the values pointed at by dest,
+// converting them like sql.Rows.Scan does for the common Go types and
+// sql.Scanner implementations.
+func (r *Rows) Scan(dest ...interface{}) error {
+	if r.i == 0 || r.i > len(r.res.rows) {
+		return errors.New("sqlcache: Scan called without calling Next")
+	}
+	row := r.res.rows[r.i-1]
+	if len(dest) != len(row) {
+		return fmt.Errorf("sqlcache: expected %d destination arguments in Scan, not %d", len(row), len(dest))
+	}
+	for i, src := range row {
+		if err := assign(dest[i], src); err != nil {
+			return fmt.Errorf("sqlcache: Scan error on column index %d, name %q: %w", i, r.res.columns[i], err)
+		}
+	}
+	return nil
+}
+
+// Always returns nil: errors are reported by the query itself, since its
+// rows are read in full before it returns. Err exists for compatibility with
+// sql.Rows.
+func (r *Rows) Err() error {
+	return nil
+}
+
+// Close exists for compatibility with sql.Rows, and does nothing.
+func (r *Rows) Close() error {
+	return nil
+}
+
+// cloneValue copies []byte values, so that callers can't modify the cached
+// result.
+func cloneValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return append([]byte(nil), b...)
+	}
+	return v
+}
+
+// assign stores the driver value src in dest.
+func assign(dest, src interface{}) error {
+	switch d := dest.(type) {
+	case sql.Scanner:
+		return d.Scan(cloneValue(src))
+	case *interface{}:
+		*d = cloneValue(src)
+		return nil
+	case *string:
+		switch s := src.(type) {
+		case string:
+			*d = s
+			return nil
+		case []byte:
+			*d = string(s)
+			return nil
+		case time.Time:
+			*d = s.Format(time.RFC3339Nano)
+			return nil
+		case nil:
+		default:
+			*d = fmt.Sprint(s)
+			return nil
+		}
+	case *[]byte:
+		switch s := src.(type) {
+		case []byte:
+			*d = cloneValue(s).([]byte)
+			return nil
+		case string:
+			*d = []byte(s)
+			return nil
+		case nil:
+			*d = nil
+			return nil
+		}
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return errors.New("destination not a non-nil pointer")
+	}
+	dv = dv.Elem()
+	if src == nil {
+		switch dv.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+			dv.Set(reflect.Zero(dv.Type()))
+			return nil
+		}
+		return fmt.Errorf("converting NULL to %s is unsupported", dv.Kind())
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dv.Type()) {
+		dv.Set(reflect.ValueOf(cloneValue(src)))
+		return nil
+	}
+	if dv.Kind() == reflect.Pointer {
+		// Scan into a new value, as sql.Rows does for e.g. *int64
+		nv := reflect.New(dv.Type().Elem())
+		if err := assign(nv.Interface(), src); err != nil {
+			return err
+		}
+		dv.Set(nv)
+		return nil
+	}
+
+	var text string
+	switch s := src.(type) {
+	case string:
+		text = s
+	case []byte:
+		text = string(s)
+	default:
+		text = fmt.Sprint(s)
+	}
+	switch dv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, dv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("converting %T %q to %s: %w", src, text, dv.Kind(), err)
+		}
+		dv.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, dv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("converting %T %q to %s: %w", src, text, dv.Kind(), err)
+		}
+		dv.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, dv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("converting %T %q to %s: %w", src, text, dv.Kind(), err)
+		}
+		dv.SetFloat(f)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("converting %T %q to bool: %w", src, text, err)
+		}
+		dv.SetBool(b)
+		return nil
+	case reflect.String:
+		dv.SetString(text)
+		return nil
+	}
+	return fmt.Errorf("unsupported Scan, storing driver value of type %T into type %T", src, dest)
+}
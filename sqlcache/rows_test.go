@@ -0,0 +1,68 @@
+package sqlcache
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestRowsScan(t *testing.T) {
+	now := time.Now()
+	res := &result{
+		columns: []string{"i", "s", "b", "f", "t", "n"},
+		rows: [][]interface{}{
+			{int64(7), []byte("text"), true, 1.5, now, nil},
+		},
+	}
+	r := &Rows{res: res}
+	if err := r.Scan(new(int64)); err == nil {
+		t.Error("Scan before Next succeeded")
+	}
+	if !r.Next() {
+		t.Fatal("No rows")
+	}
+
+	var (
+		i  int
+		s  string
+		b  bool
+		f  float32
+		tm time.Time
+		n  sql.NullString
+	)
+	if err := r.Scan(&i, &s, &b, &f, &tm, &n); err != nil {
+		t.Fatal(err)
+	}
+	if i != 7 || s != "text" || !b || f != 1.5 || !tm.Equal(now) || n.Valid {
+		t.Error("Unexpected values:", i, s, b, f, tm, n)
+	}
+
+	var (
+		is string
+		bs []byte
+		x  interface{}
+		p  *int64
+		np *string
+	)
+	if err := r.Scan(&p, &bs, &x, &is, &x, &np); err != nil {
+		t.Fatal(err)
+	}
+	if is != "1.5" || string(bs) != "text" || p == nil || *p != 7 || np != nil {
+		t.Error("Unexpected values:", is, bs, p, np)
+	}
+	// Scanned []byte values must not alias the cached result
+	bs[0] = 'T'
+	if string(res.rows[0][1].([]byte)) != "text" {
+		t.Error("Scan exposed the cached result")
+	}
+
+	if err := r.Scan(&i, &i, &i, &i, &i, &i); err == nil {
+		t.Error("Scanning text into an int succeeded")
+	}
+	if err := r.Scan(&i); err == nil {
+		t.Error("Scan with the wrong number of arguments succeeded")
+	}
+	if r.Next() {
+		t.Error("Next returned a second row")
+	}
+}
@@ -0,0 +1,180 @@
+package sqlcache
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tableKeywords are the keywords after which a table name is expected.
+var tableKeywords = map[string]bool{
+	"from":     true,
+	"join":     true,
+	"into":     true,
+	"update":   true,
+	"table":    true,
+	"truncate": true,
+}
+
+// modifiers may come between a table keyword and the table name, as in
+// TRUNCATE TABLE t or CREATE TABLE IF NOT EXISTS t.
+var modifiers = map[string]bool{
+	"table": true, "if": true, "not": true, "exists": true, "only": true,
+}
+
+// keywords can't be table names or aliases, and end a list of tables.
+var keywords = map[string]bool{
+	"where": true, "join": true, "inner": true, "left": true, "right": true,
+	"full": true, "cross": true, "outer": true, "natural": true, "on": true,
+	"using": true, "group": true, "order": true, "limit": true, "offset": true,
+	"having": true, "union": true, "except": true, "intersect": true,
+	"set": true, "values": true, "select": true, "returning": true,
+	"for": true, "window": true, "fetch": true, "table": true, "if": true,
+	"exists": true, "not": true, "only": true, "lateral": true, "as": true,
+	"default": true, "of": true, "from": true, "into": true, "with": true,
+}
+
+// tables returns the lower-case names of the tables a statement reads or
+// writes, found by looking for names following FROM, JOIN, INTO, UPDATE,
+// TABLE and TRUNCATE, including comma-separated lists after FROM. Schema
+// qualifiers are dropped. The parsing is naive: tables referenced in other
+// ways, e.g. through views or functions, are missed.
+func tables(query string) []string {
+	toks := tokenize(query)
+	lower := make([]string, len(toks))
+	for i, t := range toks {
+		lower[i] = strings.ToLower(t)
+	}
+	seen := make(map[string]bool)
+	var names []string
+	add := func(j int) bool {
+		if j >= len(toks) {
+			return false
+		}
+		name, ok := tableName(toks[j])
+		if ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return ok
+	}
+
+	for i, kw := range lower {
+		if !tableKeywords[kw] {
+			continue
+		}
+		// SELECT ... FOR UPDATE locks rows rather than naming a table
+		if kw == "update" && i > 0 && lower[i-1] == "for" {
+			continue
+		}
+		j := i + 1
+		for j < len(toks) && modifiers[lower[j]] {
+			j++
+		}
+		if !add(j) || kw != "from" {
+			continue
+		}
+		// FROM a [AS] x, b y, ...
+		for {
+			if j+2 < len(toks) && lower[j+1] == "as" {
+				j += 2
+			} else if j+1 < len(toks) && isIdentifier(toks[j+1]) && !keywords[lower[j+1]] {
+				j++
+			}
+			if j+1 == len(toks) || toks[j+1] != "," || !add(j+2) {
+				break
+			}
+			j += 2
+		}
+	}
+	return names
+}
+
+// tableName returns the normalized name of a table token, or false if the
+// token can't be a table name.
+func tableName(tok string) (string, bool) {
+	if !isIdentifier(tok) || keywords[strings.ToLower(tok)] {
+		return "", false
+	}
+	if i := strings.LastIndexByte(tok, '.'); i >= 0 {
+		tok = tok[i+1:]
+	}
+	tok = strings.Trim(tok, "\"`[]")
+	if tok == "" {
+		return "", false
+	}
+	return strings.ToLower(tok), true
+}
+
+func isIdentifier(tok string) bool {
+	r, _ := utf8.DecodeRuneInString(tok)
+	return r == '"' || r == '`' || r == '[' || r == '_' || unicode.IsLetter(r)
+}
+
+// tokenize splits a statement into identifiers (possibly quoted and
+// schema-qualified), numbers and single punctuation characters, skipping
+// string literals and comments.
+func tokenize(s string) []string {
+	var toks []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && i+1 < len(s) && s[i+1] == '-':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return toks
+			}
+			i += end + 4
+		case c == '\'':
+			// A doubled quote escape is skipped as two adjacent literals
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return toks
+			}
+			i += end + 2
+		case isWordByte(c) || closingQuote(c) != 0:
+			start := i
+			for i < len(s) {
+				if q := closingQuote(s[i]); q != 0 {
+					end := strings.IndexByte(s[i+1:], q)
+					if end < 0 {
+						i = len(s)
+						break
+					}
+					i += end + 2
+				} else if isWordByte(s[i]) || s[i] == '.' {
+					i++
+				} else {
+					break
+				}
+			}
+			toks = append(toks, s[start:i])
+		default:
+			toks = append(toks, string(c))
+			i++
+		}
+	}
+	return toks
+}
+
+// closingQuote returns the character closing a quoted identifier opened by c,
+// or 0 if c doesn't open one.
+func closingQuote(c byte) byte {
+	switch c {
+	case '"', '`':
+		return c
+	case '[':
+		return ']'
+	}
+	return 0
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
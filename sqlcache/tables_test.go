@@ -0,0 +1,32 @@
+package sqlcache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTables(t *testing.T) {
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT * FROM users WHERE id = ?", []string{"users"}},
+		{"select u.name from Users u join orders o on o.user_id = u.id", []string{"users", "orders"}},
+		{"SELECT * FROM a, b AS y, public.c z WHERE a.id = b.id", []string{"a", "b", "c"}},
+		{`SELECT * FROM "Quoted Table" LEFT JOIN [x].[y] ON 1 = 1`, []string{"quoted table", "y"}},
+		{"SELECT * FROM (SELECT id FROM inner_t) s", []string{"inner_t"}},
+		{"SELECT 'from fake' FROM real -- join commented", []string{"real"}},
+		{"SELECT * FROM t /* FROM hidden */ FOR UPDATE", []string{"t"}},
+		{"INSERT INTO audit (msg) SELECT msg FROM log", []string{"audit", "log"}},
+		{"UPDATE users SET name = 'x'", []string{"users"}},
+		{"DELETE FROM sessions WHERE expired", []string{"sessions"}},
+		{"TRUNCATE TABLE events", []string{"events"}},
+		{"CREATE TABLE IF NOT EXISTS `kv` (k text)", []string{"kv"}},
+		{"SELECT 1", nil},
+	}
+	for _, c := range cases {
+		if got := tables(c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("tables(%q) = %q, expected %q", c.query, got, c.want)
+		}
+	}
+}
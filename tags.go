@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// tagIndex maps tags to the keys carrying them, and keys back to their tags,
+// so that InvalidateTag can find its items without scanning the cache.
+type tagIndex struct {
+	mu     sync.Mutex
+	keys   map[string]map[string]struct{}
+	tags   map[string][]string
+	tagged atomic.Int32 // number of tagged keys; lets untagged writes skip mu
+}
+
+func (t *tagIndex) set(k string, tags []string) {
+	t.mu.Lock()
+	t.removeLocked(k)
+	if len(tags) > 0 {
+		if t.keys == nil {
+			t.keys = make(map[string]map[string]struct{})
+			t.tags = make(map[string][]string)
+		}
+		for _, tag := range tags {
+			ks, ok := t.keys[tag]
+			if !ok {
+				ks = make(map[string]struct{})
+				t.keys[tag] = ks
+			}
+			ks[k] = struct{}{}
+		}
+		t.tags[k] = append([]string(nil), tags...)
+		t.tagged.Inc()
+	}
+	t.mu.Unlock()
+}
+
+func (t *tagIndex) remove(k string) {
+	if t.tagged.Load() == 0 {
+		return
+	}
+	t.mu.Lock()
+	t.removeLocked(k)
+	t.mu.Unlock()
+}
+
+func (t *tagIndex) removeLocked(k string) {
+	tags, ok := t.tags[k]
+	if !ok {
+		return
+	}
+	for _, tag := range tags {
+		ks := t.keys[tag]
+		delete(ks, k)
+		if len(ks) == 0 {
+			delete(t.keys, tag)
+		}
+	}
+	delete(t.tags, k)
+	t.tagged.Dec()
+}
+
+// lookup returns a copy of the keys carrying tag.
+func (t *tagIndex) lookup(tag string) []string {
+	t.mu.Lock()
+	ks := make([]string, 0, len(t.keys[tag]))
+	for k := range t.keys[tag] {
+		ks = append(ks, k)
+	}
+	t.mu.Unlock()
+	return ks
+}
+
+func (t *tagIndex) has(k, tag string) bool {
+	t.mu.Lock()
+	_, ok := t.keys[tag][k]
+	t.mu.Unlock()
+	return ok
+}
+
+// Add an item to the cache, replacing any existing item, and associate it with
+// the given tags. Overwriting or deleting the item drops its tags. See Set for
+// the meaning of d.
+func (c *cache) SetWithTags(k string, x interface{}, d time.Duration, tags ...string) {
+	defer c.lockKey(k)()
+
+	c.set(k, x, d)
+	c.tags.set(k, tags)
+}
+
+// Returns the tags associated with an item, or nil if it has none.
+func (c *cache) Tags(k string) []string {
+	c.tags.mu.Lock()
+	defer c.tags.mu.Unlock()
+	tags := c.tags.tags[k]
+	if tags == nil {
+		return nil
+	}
+	return append([]string(nil), tags...)
+}
+
+// Delete every item carrying the given tag. Returns the number of items
+// removed.
+func (c *cache) InvalidateTag(tag string) int {
+	var evictedItems []keyAndValue
+	keys := c.tags.lookup(tag)
+
+	n := 0
+
+	for _, k := range keys {
+		unlock := c.lockKey(k)
+		// The item may have been overwritten since the lookup
+		if c.tags.has(k, tag) {
+			ov, evicted := c.delete(k)
+			if evicted {
+				evictedItems = append(evictedItems, keyAndValue{k, ov})
+			}
+			n++
+		}
+		unlock()
+	}
+
+	for _, v := range evictedItems {
+		c.onEvicted(v.key, v.value)
+	}
+	return n
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInvalidateTag(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetWithTags("page:1", "a", DefaultExpiration, "user:5", "product:9")
+	tc.SetWithTags("page:2", "b", DefaultExpiration, "user:5")
+	tc.SetWithTags("page:3", "c", DefaultExpiration, "product:9")
+	tc.Set("page:4", "d", DefaultExpiration)
+
+	evicted := 0
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted++
+	})
+
+	if n := tc.InvalidateTag("user:5"); n != 2 {
+		t.Errorf("InvalidateTag removed %d items, expected 2", n)
+	}
+	if evicted != 2 {
+		t.Errorf("OnEvicted was called %d times, expected 2", evicted)
+	}
+	if _, found := tc.Get("page:1"); found {
+		t.Error("page:1 was found, but it should have been invalidated")
+	}
+	if _, found := tc.Get("page:3"); !found {
+		t.Error("page:3 was not found")
+	}
+	if _, found := tc.Get("page:4"); !found {
+		t.Error("page:4 was not found")
+	}
+	if n := tc.InvalidateTag("product:9"); n != 1 {
+		t.Errorf("InvalidateTag removed %d items, expected 1", n)
+	}
+	if n := tc.InvalidateTag("user:5"); n != 0 {
+		t.Errorf("InvalidateTag removed %d items after the tag was emptied", n)
+	}
+}
+
+func TestTagsOverwriteAndDelete(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetWithTags("a", 1, DefaultExpiration, "t")
+	tc.SetWithTags("b", 2, DefaultExpiration, "t")
+	tc.SetWithTags("c", 3, DefaultExpiration, "t")
+
+	tc.Set("a", 10, DefaultExpiration)
+	if tags := tc.Tags("a"); tags != nil {
+		t.Error("overwritten item still has tags:", tags)
+	}
+	if _, err := tc.IncrementInt("b", 1); err != nil {
+		t.Error("Error incrementing b:", err)
+	}
+	if tags := tc.Tags("b"); len(tags) != 1 || tags[0] != "t" {
+		t.Error("incremented item lost its tags:", tags)
+	}
+	tc.Delete("c")
+
+	if n := tc.InvalidateTag("t"); n != 1 {
+		t.Errorf("InvalidateTag removed %d items, expected 1", n)
+	}
+	if _, found := tc.Get("a"); !found {
+		t.Error("a was invalidated even though it was overwritten without tags")
+	}
+}
+
+func TestTagsDeleteExpiredAndFlush(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetWithTags("a", 1, time.Millisecond, "t")
+	tc.SetWithTags("b", 2, DefaultExpiration, "t")
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if tags := tc.Tags("a"); tags != nil {
+		t.Error("expired item still has tags:", tags)
+	}
+
+	tc.Flush()
+	if tags := tc.Tags("b"); tags != nil {
+		t.Error("flushed item still has tags:", tags)
+	}
+	if n := tc.InvalidateTag("t"); n != 0 {
+		t.Errorf("InvalidateTag removed %d items after Flush", n)
+	}
+}
+
+func TestTagsReplacedExpired(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.SetWithTags("page", "a", time.Millisecond, "user:5")
+	<-time.After(5 * time.Millisecond)
+	tc.ComputeIfAbsent("page", func() (interface{}, bool) {
+		return "b", true
+	}, DefaultExpiration)
+	if tags := tc.Tags("page"); tags != nil {
+		t.Error("page kept the tags of the expired item:", tags)
+	}
+	if n := tc.InvalidateTag("user:5"); n != 0 {
+		t.Errorf("InvalidateTag removed %d items, expected 0", n)
+	}
+}
+
+func TestTagsSetDuringFlush(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	for i := 0; i < 1000; i++ {
+		tc.Set("old"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			tc.SetWithTags("k"+strconv.Itoa(i), i, DefaultExpiration, "t")
+		}
+	}()
+flush:
+	for {
+		select {
+		case <-done:
+			break flush
+		default:
+			tc.Flush()
+		}
+	}
+
+	keys := tc.Keys()
+	for _, k := range keys {
+		if tags := tc.Tags(k); len(tags) != 1 || tags[0] != "t" {
+			t.Errorf("%s lost its tags: %v", k, tags)
+		}
+	}
+	if n := tc.InvalidateTag("t"); n != len(keys) {
+		t.Errorf("InvalidateTag removed %d items, expected %d", n, len(keys))
+	}
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"math"
+	"time"
+)
+
+// Reset the expiration of an existing item to d from now (see Set for the
+// meaning of d), without changing its value. Returns an error wrapping
+// ErrNotFound if the item doesn't exist or has expired.
+func (c *cache) Touch(k string, d time.Duration) error {
+	return c.setExpiration(k, c.expiration(d))
+}
+
+// Make an existing item never expire. Returns an error wrapping ErrNotFound if
+// the item doesn't exist or has expired.
+func (c *cache) Persist(k string) error {
+	return c.setExpiration(k, 0)
+}
+
+// Make an existing item expire at t. A t in the past, including the zero
+// time, makes the item expire immediately. Returns an error wrapping
+// ErrNotFound if the item doesn't exist or has expired.
+func (c *cache) ExpireAt(k string, t time.Time) error {
+	// Expirations are stored in Unix nanoseconds, where 0 means none, so
+	// times outside the range of positive int64s must be clamped
+	e := t.UnixNano()
+	switch {
+	case !t.After(time.Unix(0, 0)):
+		e = 1
+	case t.After(time.Unix(0, math.MaxInt64)):
+		e = math.MaxInt64
+	}
+	return c.setExpiration(k, e)
+}
+
+// Returns the time remaining until an item expires, or NoExpiration if it
+// never expires, and a bool indicating whether the key was found.
+func (c *cache) TTL(k string) (time.Duration, bool) {
+	item, found := c.items.Load(k)
+	if !found {
+		return 0, false
+	}
+	e := item.(Item).Expiration
+	if e <= 0 {
+		return NoExpiration, true
+	}
+	ttl := time.Duration(e - time.Now().UnixNano())
+	if ttl < 0 {
+		return 0, false
+	}
+	return ttl, true
+}
+
+func (c *cache) setExpiration(k string, e int64) error {
+	defer c.lockKey(k)()
+
+	item, found := c.items.Load(k)
+	if !found || item.(Item).Expired() {
+		return notFoundError(k)
+	}
+	v := item.(Item)
+	v.Expiration = e
+	// Store directly rather than with safeStore: only the expiration
+	// changes, so the item keeps its version.
+	c.items.Store(k, v)
+	return nil
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTouch(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, 20*time.Millisecond)
+	_, v1, _ := tc.GetWithVersion("a")
+	if err := tc.Touch("a", time.Hour); err != nil {
+		t.Fatal("Error touching a:", err)
+	}
+	<-time.After(30 * time.Millisecond)
+	x, v2, found := tc.GetWithVersion("a")
+	if !found || x.(int) != 1 {
+		t.Fatal("a expired after being touched")
+	}
+	if v1 != v2 {
+		t.Error("Touch changed the version of a")
+	}
+	if ttl, _ := tc.TTL("a"); ttl < 59*time.Minute || ttl > time.Hour {
+		t.Error("Unexpected TTL for a:", ttl)
+	}
+	if err := tc.Touch("missing", time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Error("Touch on a missing item returned", err)
+	}
+}
+
+func TestPersistAndExpireAt(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, 20*time.Millisecond)
+	if err := tc.Persist("a"); err != nil {
+		t.Fatal("Error persisting a:", err)
+	}
+	if ttl, found := tc.TTL("a"); !found || ttl != NoExpiration {
+		t.Error("a did not become persistent:", ttl, found)
+	}
+
+	deadline := time.Now().Add(20 * time.Millisecond)
+	if err := tc.ExpireAt("a", deadline); err != nil {
+		t.Fatal("Error setting the expiration of a:", err)
+	}
+	_, expiration, _ := tc.GetWithExpiration("a")
+	if !expiration.Equal(deadline) {
+		t.Error("a does not expire at the deadline:", expiration)
+	}
+	<-time.After(30 * time.Millisecond)
+	if _, found := tc.Get("a"); found {
+		t.Error("a was found after its deadline")
+	}
+	if _, found := tc.TTL("a"); found {
+		t.Error("TTL found an expired item")
+	}
+	if err := tc.Persist("a"); !errors.Is(err, ErrNotFound) {
+		t.Error("Persist on an expired item returned", err)
+	}
+}
+
+func TestExpireAtOutOfRange(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	for _, deadline := range []time.Time{{}, time.Unix(-1, 0), time.Unix(0, 0)} {
+		tc.Set("a", 1, DefaultExpiration)
+		if err := tc.ExpireAt("a", deadline); err != nil {
+			t.Fatal("Error setting the expiration of a:", err)
+		}
+		if _, found := tc.Get("a"); found {
+			t.Errorf("a was found after expiring at %v", deadline)
+		}
+		if ttl, found := tc.TTL("a"); found {
+			t.Errorf("TTL found a after it expired at %v: %v", deadline, ttl)
+		}
+	}
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.ExpireAt("a", time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC))
+	if ttl, found := tc.TTL("a"); !found || ttl < 200*365*24*time.Hour {
+		t.Error("Unexpected TTL for a far deadline:", ttl, found)
+	}
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"sort"
+	"time"
+)
+
+// maxTxnAttempts bounds the number of times Txn runs a conflicting
+// transaction before giving up.
+const maxTxnAttempts = 64
+
+// A Tx buffers the reads and writes of a transaction started with Txn.
+type Tx struct {
+	c      *cache
+	reads  map[string]uint64
+	writes map[string]txWrite
+}
+
+type txWrite struct {
+	object  interface{}
+	d       time.Duration
+	deleted bool
+}
+
+// Get an item as seen by the transaction: the transaction's own pending write
+// if there is one, otherwise the item in the cache. The item's version is
+// recorded and checked again when the transaction commits.
+func (tx *Tx) Get(k string) (interface{}, bool) {
+	if w, ok := tx.writes[k]; ok {
+		if w.deleted {
+			return nil, false
+		}
+		return w.object, true
+	}
+	x, version, found := tx.c.GetWithVersion(k)
+	if _, ok := tx.reads[k]; !ok {
+		tx.reads[k] = version
+	}
+	return x, found
+}
+
+// Set an item when the transaction commits. See Cache.Set for the meaning of
+// d.
+func (tx *Tx) Set(k string, x interface{}, d time.Duration) {
+	tx.writes[k] = txWrite{object: x, d: d}
+}
+
+// Delete an item when the transaction commits.
+func (tx *Tx) Delete(k string) {
+	tx.writes[k] = txWrite{deleted: true}
+}
+
+// Run fn as an optimistic transaction. The writes made through tx are
+// buffered, and applied atomically once fn returns nil, provided that none of
+// the items read through tx has been modified since. If one has, fn is run
+// again with a fresh Tx; after repeated conflicts Txn gives up and returns
+// ErrTxnConflict. If fn returns an error, nothing is written and the error is
+// returned.
+//
+// fn may be run several times, so it should have no side effects besides
+// those made through tx.
+func (c *cache) Txn(fn func(tx *Tx) error) error {
+	for attempt := 0; attempt < maxTxnAttempts; attempt++ {
+		tx := &Tx{
+			c:      c,
+			reads:  make(map[string]uint64),
+			writes: make(map[string]txWrite),
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if tx.commit() {
+			return nil
+		}
+	}
+	return ErrTxnConflict
+}
+
+// commit applies the transaction's writes if its reads are still valid, and
+// reports whether it did.
+func (tx *Tx) commit() bool {
+	c := tx.c
+
+	// Lock every stripe touched by the transaction, in ascending order so
+	// that concurrent commits can't deadlock.
+	var stripes []int
+	seen := make(map[int]bool)
+	addStripe := func(k string) {
+		if i := keyLockIndex(k); !seen[i] {
+			seen[i] = true
+			stripes = append(stripes, i)
+		}
+	}
+	for k := range tx.reads {
+		addStripe(k)
+	}
+	for k := range tx.writes {
+		addStripe(k)
+	}
+	sort.Ints(stripes)
+	for _, i := range stripes {
+		c.keyLocks[i].Lock()
+	}
+	unlock := func() {
+		for _, i := range stripes {
+			c.keyLocks[i].Unlock()
+		}
+	}
+
+	for k, version := range tx.reads {
+		var current uint64
+		if v, found := c.items.Load(k); found && !v.(Item).Expired() {
+			current = v.(Item).Version
+		}
+		if current != version {
+			unlock()
+			return false
+		}
+	}
+
+	var evictedItems []keyAndValue
+	for k, w := range tx.writes {
+		if w.deleted {
+			ov, evicted := c.delete(k)
+			if evicted {
+				evictedItems = append(evictedItems, keyAndValue{k, ov})
+			}
+			continue
+		}
+		c.set(k, w.object, w.d)
+	}
+	unlock()
+
+	for _, v := range evictedItems {
+		c.onEvicted(v.key, v.value)
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTxn(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 100, DefaultExpiration)
+	tc.Set("b", 0, DefaultExpiration)
+	tc.Set("c", "gone", DefaultExpiration)
+
+	err := tc.Txn(func(tx *Tx) error {
+		a, _ := tx.Get("a")
+		b, _ := tx.Get("b")
+		tx.Set("a", a.(int)-30, DefaultExpiration)
+		tx.Set("b", b.(int)+30, DefaultExpiration)
+		tx.Delete("c")
+		if x, _ := tx.Get("a"); x.(int) != 70 {
+			t.Error("Tx did not see its own write to a:", x)
+		}
+		if _, found := tx.Get("c"); found {
+			t.Error("Tx did not see its own delete of c")
+		}
+		if x, _ := tc.Get("a"); x.(int) != 100 {
+			t.Error("Tx write to a was visible before commit:", x)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("Txn failed:", err)
+	}
+	if x, _ := tc.Get("a"); x.(int) != 70 {
+		t.Error("a is not 70:", x)
+	}
+	if x, _ := tc.Get("b"); x.(int) != 30 {
+		t.Error("b is not 30:", x)
+	}
+	if _, found := tc.Get("c"); found {
+		t.Error("c was found, but it should have been deleted")
+	}
+}
+
+func TestTxnAbort(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	errAbort := errors.New("abort")
+	err := tc.Txn(func(tx *Tx) error {
+		tx.Set("a", 2, DefaultExpiration)
+		return errAbort
+	})
+	if err != errAbort {
+		t.Error("Txn did not return the error from fn:", err)
+	}
+	if x, _ := tc.Get("a"); x.(int) != 1 {
+		t.Error("a was modified by an aborted transaction:", x)
+	}
+}
+
+func TestTxnRetry(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	attempts := 0
+	err := tc.Txn(func(tx *Tx) error {
+		attempts++
+		a, _ := tx.Get("a")
+		if attempts == 1 {
+			// Simulate a concurrent writer
+			tc.Set("a", 10, DefaultExpiration)
+		}
+		tx.Set("a", a.(int)+1, DefaultExpiration)
+		return nil
+	})
+	if err != nil {
+		t.Fatal("Txn failed:", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Txn ran fn %d times, expected 2", attempts)
+	}
+	if x, _ := tc.Get("a"); x.(int) != 11 {
+		t.Error("a is not 11:", x)
+	}
+
+	err = tc.Txn(func(tx *Tx) error {
+		tx.Get("a")
+		tc.Set("a", 0, DefaultExpiration)
+		return nil
+	})
+	if err != ErrTxnConflict {
+		t.Error("Txn did not give up on a key that is always modified:", err)
+	}
+}
+
+func TestTxnConcurrent(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("a", 1000, DefaultExpiration)
+	tc.Set("b", 0, DefaultExpiration)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				err := tc.Txn(func(tx *Tx) error {
+					a, _ := tx.Get("a")
+					b, _ := tx.Get("b")
+					tx.Set("a", a.(int)-1, DefaultExpiration)
+					tx.Set("b", b.(int)+1, DefaultExpiration)
+					return nil
+				})
+				if err != nil {
+					t.Error("Txn failed:", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	a, _ := tc.Get("a")
+	b, _ := tc.Get("b")
+	if a.(int) != 600 || b.(int) != 400 {
+		t.Errorf("a and b are %d and %d, expected 600 and 400", a, b)
+	}
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// errUnchanged is returned by modify callbacks to leave the item as it is.
+var errUnchanged = errors.New("cache: item unchanged")
+
+// expiration converts a duration as accepted by Set into an absolute
+// expiration time in nanoseconds, or 0 if the item shouldn't expire.
+func (c *cache) expiration(d time.Duration) int64 {
+	if d == DefaultExpiration {
+		d = c.defaultExpiration
+	}
+	if d > 0 {
+		return time.Now().Add(d).UnixNano()
+	}
+	return 0
+}
+
+// modify runs fn on the item stored under k while holding the key's lock, so
+// that the read-modify-write is atomic with respect to other writers. An
+// expired item is passed to fn as not found. If fn returns an error nothing
+// is changed; otherwise the returned item is stored if keep is true, and any
+// existing item is deleted (calling OnEvicted) if keep is false. modify
+// returns the item left in the cache and whether there is one.
+func (c *cache) modify(k string, fn func(item Item, found bool) (Item, bool, error)) (Item, bool, error) {
+	item, found, ov, evicted, err := c.modifyLocked(k, fn)
+	if evicted {
+		c.onEvicted(k, ov)
+	}
+	return item, found, err
+}
+
+// modifyLocked does the work of modify under the key's lock, which is released
+// even if fn panics. It returns the value OnEvicted should be called with, if
+// any, once the lock has been released.
+func (c *cache) modifyLocked(k string, fn func(item Item, found bool) (Item, bool, error)) (Item, bool, interface{}, bool, error) {
+	defer c.lockKey(k)()
+
+	v, present := c.items.Load(k)
+	var item Item
+	if present {
+		item = v.(Item)
+	}
+	found := present && !item.Expired()
+	if !found {
+		item = Item{}
+	}
+
+	nv, keep, err := fn(item, found)
+	if err != nil {
+		return item, found, nil, false, err
+	}
+	if keep {
+		c.safeStore(k, nv)
+		if !found {
+			// The tags of an expired item don't carry over to its replacement
+			c.tags.remove(k)
+		}
+		return nv, true, nil, false, nil
+	}
+
+	var (
+		ov      interface{}
+		evicted bool
+	)
+	if present {
+		ov, evicted = c.delete(k)
+	}
+	return Item{}, false, ov, evicted, nil
+}
+
+// Atomically update an item. fn is called with the current value and whether
+// it exists (an expired item is reported as not existing), and returns the
+// new value, its expiration duration (see Set), and whether to keep it. If
+// keep is false the item is deleted, and OnEvicted is called if there was an
+// item, expired or not. Update returns the new value and whether it was kept.
+//
+// fn runs while writes to the key are locked out, and must not call back into
+// the cache's write methods.
+func (c *cache) Update(k string, fn func(old interface{}, exists bool) (interface{}, time.Duration, bool)) (interface{}, bool) {
+	item, found, _ := c.modify(k, func(item Item, found bool) (Item, bool, error) {
+		x, d, keep := fn(item.Object, found)
+		return Item{Object: x, Expiration: c.expiration(d)}, keep, nil
+	})
+	return item.Object, found
+}
+
+// Like Update, but fn can also return an error, in which case the item is
+// left as it is and TryUpdate returns the error along with the current value
+// and whether there is one.
+func (c *cache) TryUpdate(k string, fn func(old interface{}, exists bool) (interface{}, time.Duration, bool, error)) (interface{}, bool, error) {
+	item, found, err := c.modify(k, func(item Item, found bool) (Item, bool, error) {
+		x, d, keep, err := fn(item.Object, found)
+		if err != nil {
+			return item, found, err
+		}
+		return Item{Object: x, Expiration: c.expiration(d)}, keep, nil
+	})
+	return item.Object, found, err
+}
+
+// Like Update, but the new value, if kept, is stored with the expiration
+// duration d.
+func (c *cache) Compute(k string, fn func(old interface{}, exists bool) (interface{}, bool), d time.Duration) (interface{}, bool) {
+	return c.Update(k, func(old interface{}, exists bool) (interface{}, time.Duration, bool) {
+		x, keep := fn(old, exists)
+		return x, d, keep
+	})
+}
+
+// If the key doesn't exist or has expired, atomically set it to the value
+// returned by fn with the expiration duration d, unless fn returns false.
+// Returns the value now stored under the key, and whether there is one.
+func (c *cache) ComputeIfAbsent(k string, fn func() (interface{}, bool), d time.Duration) (interface{}, bool) {
+	item, found, _ := c.modify(k, func(item Item, found bool) (Item, bool, error) {
+		if found {
+			return item, true, errUnchanged
+		}
+		x, keep := fn()
+		return Item{Object: x, Expiration: c.expiration(d)}, keep, nil
+	})
+	return item.Object, found
+}
+
+// If the key exists and hasn't expired, atomically replace its value with the
+// one returned by fn, stored with the expiration duration d, or delete it if
+// fn returns false. Returns the value now stored under the key, and whether
+// there is one.
+func (c *cache) ComputeIfPresent(k string, fn func(old interface{}) (interface{}, bool), d time.Duration) (interface{}, bool) {
+	item, found, _ := c.modify(k, func(item Item, found bool) (Item, bool, error) {
+		if !found {
+			return item, false, errUnchanged
+		}
+		x, keep := fn(item.Object)
+		return Item{Object: x, Expiration: c.expiration(d)}, keep, nil
+	})
+	return item.Object, found
+}
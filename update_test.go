@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdate(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	x, kept := tc.Update("list", func(old interface{}, exists bool) (interface{}, time.Duration, bool) {
+		if exists {
+			t.Error("list exists before being created")
+		}
+		return []string{"a"}, NoExpiration, true
+	})
+	if !kept || len(x.([]string)) != 1 {
+		t.Error("Update did not create list:", x)
+	}
+	x, kept = tc.Update("list", func(old interface{}, exists bool) (interface{}, time.Duration, bool) {
+		return append(old.([]string), "b"), 50 * time.Millisecond, true
+	})
+	if !kept || len(x.([]string)) != 2 {
+		t.Error("Update did not append to list:", x)
+	}
+	_, expiration, _ := tc.GetWithExpiration("list")
+	if expiration.IsZero() {
+		t.Error("Update did not set the expiration of list")
+	}
+
+	var evicted interface{}
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = v
+	})
+	_, kept = tc.Update("list", func(old interface{}, exists bool) (interface{}, time.Duration, bool) {
+		return nil, DefaultExpiration, false
+	})
+	if kept {
+		t.Error("Update kept list when it should have been deleted")
+	}
+	if _, found := tc.Get("list"); found {
+		t.Error("list was found, but it should have been deleted")
+	}
+	if evicted == nil || len(evicted.([]string)) != 2 {
+		t.Error("OnEvicted was not called with the deleted list:", evicted)
+	}
+}
+
+func TestUpdateExpired(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("foo", "bar", time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	tc.Update("foo", func(old interface{}, exists bool) (interface{}, time.Duration, bool) {
+		if exists || old != nil {
+			t.Error("Update passed an expired item as existing:", old)
+		}
+		return "baz", DefaultExpiration, true
+	})
+	if x, _ := tc.Get("foo"); x.(string) != "baz" {
+		t.Error("foo is not baz:", x)
+	}
+}
+
+func TestUpdatePanic(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Update did not propagate the panic")
+			}
+		}()
+		tc.Update("k", func(old interface{}, exists bool) (interface{}, time.Duration, bool) {
+			panic("boom")
+		})
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		tc.Set("k", "v", DefaultExpiration)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Set blocked after a panic in Update")
+	}
+	if x, _ := tc.Get("k"); x != "v" {
+		t.Error("k is not v:", x)
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.Compute("m", func(old interface{}, exists bool) (interface{}, bool) {
+					m := map[int]int{}
+					if exists {
+						for k, v := range old.(map[int]int) {
+							m[k] = v
+						}
+					}
+					m[0]++
+					return m, true
+				}, DefaultExpiration)
+			}
+		}()
+	}
+	wg.Wait()
+	if x, _ := tc.Get("m"); x.(map[int]int)[0] != 800 {
+		t.Error("m[0] is not 800:", x)
+	}
+}
+
+func TestTryUpdate(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	tc.Set("foo", 1, DefaultExpiration)
+	_, version, _ := tc.GetWithVersion("foo")
+	errOdd := errors.New("odd")
+	x, found, err := tc.TryUpdate("foo", func(old interface{}, exists bool) (interface{}, time.Duration, bool, error) {
+		return nil, DefaultExpiration, false, errOdd
+	})
+	if err != errOdd {
+		t.Error("TryUpdate did not return the error from fn:", err)
+	}
+	if !found || x.(int) != 1 {
+		t.Error("TryUpdate did not return the current value:", x)
+	}
+	if _, v, _ := tc.GetWithVersion("foo"); v != version {
+		t.Error("TryUpdate wrote foo even though fn failed")
+	}
+	x, found, err = tc.TryUpdate("foo", func(old interface{}, exists bool) (interface{}, time.Duration, bool, error) {
+		return old.(int) + 1, DefaultExpiration, true, nil
+	})
+	if err != nil || !found || x.(int) != 2 {
+		t.Error("TryUpdate did not update foo:", x, err)
+	}
+}
+
+func TestComputeIfAbsent(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	x, found := tc.ComputeIfAbsent("foo", func() (interface{}, bool) {
+		return "bar", true
+	}, DefaultExpiration)
+	if !found || x.(string) != "bar" {
+		t.Error("ComputeIfAbsent did not set foo:", x)
+	}
+	x, found = tc.ComputeIfAbsent("foo", func() (interface{}, bool) {
+		t.Error("ComputeIfAbsent called fn for an existing key")
+		return "baz", true
+	}, DefaultExpiration)
+	if !found || x.(string) != "bar" {
+		t.Error("ComputeIfAbsent did not return the existing foo:", x)
+	}
+	_, found = tc.ComputeIfAbsent("qux", func() (interface{}, bool) {
+		return nil, false
+	}, DefaultExpiration)
+	if found {
+		t.Error("ComputeIfAbsent stored qux even though fn declined")
+	}
+}
+
+func TestComputeIfPresent(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	_, found := tc.ComputeIfPresent("foo", func(old interface{}) (interface{}, bool) {
+		t.Error("ComputeIfPresent called fn for a missing key")
+		return nil, true
+	}, DefaultExpiration)
+	if found {
+		t.Error("ComputeIfPresent created foo")
+	}
+	tc.Set("foo", 1, DefaultExpiration)
+	x, found := tc.ComputeIfPresent("foo", func(old interface{}) (interface{}, bool) {
+		return old.(int) + 1, true
+	}, DefaultExpiration)
+	if !found || x.(int) != 2 {
+		t.Error("ComputeIfPresent did not update foo:", x)
+	}
+	_, found = tc.ComputeIfPresent("foo", func(old interface{}) (interface{}, bool) {
+		return nil, false
+	}, DefaultExpiration)
+	if found {
+		t.Error("ComputeIfPresent did not delete foo")
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("foo was found, but it should have been deleted")
+	}
+}